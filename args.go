@@ -0,0 +1,769 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/reganm/ls/listing"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The settings parsed from the program arguments: the options passed on to the
+// Lister, plus the ones only used by the command itself.
+type Arguments struct {
+	options       listing.Options
+	help          bool
+	color         string // when to use color: "always", "never", "auto" or ""
+	dircolors     string // dircolors database to read the colors from
+	print_colors  string // print the colors as "gnu" or "bsd" and exit
+	width         int    // line width given by -w, or -1 if there was none
+	null          bool   // whether piped paths are separated by NUL bytes
+	files_from    string // file to read more paths from, with "-" for stdin
+	classify      bool   // whether --classify=auto depends on the output
+	hyperlink     bool   // whether --hyperlink=auto depends on the output
+	block_size    bool   // whether -h, --si or --block-size chose the units
+	kibibytes     bool   // whether -k was given
+	format        string // the layout chosen by an option, or "" for default
+	quoting       bool   // whether -N, -b or --quoting-style chose the style
+	control_chars string // "hide" or "show" from -q or --show-control-chars
+	files         []string
+}
+
+// A single command line option.  Each option has a short flag, a long flag, or
+// both, and may take an argument.  The option table below is also used to
+// generate the --help output.
+type Option struct {
+	short    rune   // e.g. 'l', or 0 if there is no short flag
+	long     string // e.g. "dirs-first", or "" if there is no long flag
+	argument string // name of the option's argument, or "" if it takes none
+	optional bool   // whether the argument may be left out
+	help     string // description for --help
+	apply    func(arguments *Arguments, value string) error
+}
+
+// An error in the program arguments, such as an unknown option.  These are
+// reported along with a pointer to --help, and exit with status 2.
+type UsageError struct {
+	message string
+}
+
+func (e UsageError) Error() string {
+	return e.message
+}
+
+// The table of all options, in the order they are listed by --help.
+var option_table = []Option{
+	{0, "block-size", "SIZE", false,
+		"show sizes in units of SIZE, e.g. 'K' or '1MB'",
+		func(arguments *Arguments, value string) error {
+			units, err := listing.ParseBlockSize(value)
+			if err != nil {
+				return UsageError{err.Error()}
+			}
+			arguments.set_units(units)
+			return nil
+		}},
+	{0, "color", "WHEN", true,
+		"use color 'always', 'never' or 'auto' (default)",
+		func(arguments *Arguments, value string) error {
+			color, err := parse_when(value, "color")
+			if err != nil {
+				return err
+			}
+			arguments.color = color
+			return nil
+		}},
+	{0, "dircolors", "FILE", false,
+		"read colors from the dircolors database FILE",
+		func(arguments *Arguments, value string) error {
+			arguments.dircolors = value
+			return nil
+		}},
+	{0, "dirs-first", "", false,
+		"list directories first",
+		func(arguments *Arguments, value string) error {
+			arguments.options.DirsFirst = true
+			return nil
+		}},
+	{0, "file-type", "", false,
+		"like -F, but without marking executables with '*'",
+		func(arguments *Arguments, value string) error {
+			arguments.set_indicator("file-type")
+			return nil
+		}},
+	{0, "files-from", "FILE", false,
+		"also list the paths in FILE ('-' for stdin)",
+		func(arguments *Arguments, value string) error {
+			arguments.files_from = value
+			return nil
+		}},
+	{0, "format", "WORD", false,
+		"lay out entries as with -C, -x, -m, -l or -1",
+		func(arguments *Arguments, value string) error {
+			format, err := parse_format(value)
+			if err != nil {
+				return err
+			}
+			arguments.set_format(format)
+			return nil
+		}},
+	{0, "full-time", "", false,
+		"like -l --time-style=full-iso",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("long")
+			arguments.options.TimeStyle = "full-iso"
+			return nil
+		}},
+	{0, "help", "", false,
+		"display usage information",
+		func(arguments *Arguments, value string) error {
+			arguments.help = true
+			return nil
+		}},
+	{0, "hyperlink", "WHEN", true,
+		"link names to their files 'always', 'never' or 'auto'",
+		func(arguments *Arguments, value string) error {
+			when, err := parse_when(value, "hyperlink")
+			if err != nil {
+				return err
+			}
+			arguments.options.Hyperlink = when != "never"
+			arguments.hyperlink = when == "auto"
+			return nil
+		}},
+	{0, "indicator-style", "WORD", false,
+		"mark types as 'none', 'slash', 'file-type' or 'classify'",
+		func(arguments *Arguments, value string) error {
+			if value != "none" && value != "slash" &&
+				value != "file-type" && value != "classify" {
+				return UsageError{fmt.Sprintf(
+					"invalid argument '%s' for '--indicator-style'", value)}
+			}
+			if value == "none" {
+				value = ""
+			}
+			arguments.set_indicator(value)
+			return nil
+		}},
+	{0, "json", "", false,
+		"list entries as JSON",
+		func(arguments *Arguments, value string) error {
+			arguments.options.JSON = true
+			return nil
+		}},
+	{0, "nocolor", "", false,
+		"remove color formatting, like --color=never",
+		func(arguments *Arguments, value string) error {
+			arguments.color = "never"
+			return nil
+		}},
+	{0, "only-dirs", "", false,
+		"only list directories, like --type=d",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Types = "d"
+			return nil
+		}},
+	{0, "only-files", "", false,
+		"only list regular files, like --type=f",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Types = "f"
+			return nil
+		}},
+	{0, "print-colors", "FORMAT", true,
+		"print LS_COLORS ('gnu') or LSCOLORS ('bsd') and exit",
+		func(arguments *Arguments, value string) error {
+			if value == "" {
+				value = "gnu"
+			} else if value != "gnu" && value != "bsd" {
+				return UsageError{fmt.Sprintf(
+					"invalid argument '%s' for '--print-colors'", value)}
+			}
+			arguments.print_colors = value
+			return nil
+		}},
+	{0, "quoting-style", "WORD", false,
+		"quote names in style WORD, e.g. 'shell' or 'c'",
+		func(arguments *Arguments, value string) error {
+			quoting_style, err := parse_quoting_style(value)
+			if err != nil {
+				return UsageError{fmt.Sprintf(
+					"invalid argument '%s' for '--quoting-style'", value)}
+			}
+			arguments.set_quoting(quoting_style)
+			return nil
+		}},
+	{0, "si", "", false,
+		"like -h, but in powers of 1000 rather than 1024",
+		func(arguments *Arguments, value string) error {
+			arguments.set_units(listing.BlockSize{Human: true, SI: true})
+			return nil
+		}},
+	{0, "show-control-chars", "", false,
+		"write unprintable characters in names as they are",
+		func(arguments *Arguments, value string) error {
+			arguments.options.HideControl = false
+			arguments.control_chars = "show"
+			return nil
+		}},
+	{0, "time", "WORD", false,
+		"show and sort by atime, ctime or birth time",
+		func(arguments *Arguments, value string) error {
+			time, err := parse_time_word(value)
+			if err != nil {
+				return err
+			}
+			arguments.options.Time = time
+			return nil
+		}},
+	{0, "time-style", "STYLE", false,
+		"full-iso, long-iso, iso, locale, relative or +FORMAT",
+		func(arguments *Arguments, value string) error {
+			time_style, err := parse_time_style(value)
+			if err != nil {
+				return err
+			}
+			arguments.options.TimeStyle = time_style
+			return nil
+		}},
+	{0, "type", "TYPES", false,
+		"only list TYPES, e.g. 'd,f,l', as with 'find -type'",
+		func(arguments *Arguments, value string) error {
+			types, err := parse_types(value)
+			if err != nil {
+				return err
+			}
+			arguments.options.Types = types
+			return nil
+		}},
+	{0, "tz", "ZONE", false,
+		"show times in ZONE, e.g. 'UTC' or 'Europe/Paris'",
+		func(arguments *Arguments, value string) error {
+			location, err := time.LoadLocation(value)
+			if err != nil || value == "" {
+				return UsageError{
+					fmt.Sprintf("invalid time zone '%s'", value)}
+			}
+			arguments.options.Location = location
+			return nil
+		}},
+	{'0', "null", "", false,
+		"paths from stdin or FILE are separated by NUL",
+		func(arguments *Arguments, value string) error {
+			arguments.null = true
+			return nil
+		}},
+	{'1', "", "", false,
+		"one entry per line",
+		func(arguments *Arguments, value string) error {
+			if !arguments.options.Long {
+				arguments.set_format("single-column")
+			}
+			return nil
+		}},
+	{'@', "xattrs", "", false,
+		"list the extended attributes of each entry",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Xattrs = true
+			return nil
+		}},
+	{'a', "all", "", false,
+		"include entries starting with '.'",
+		func(arguments *Arguments, value string) error {
+			arguments.options.All = true
+			return nil
+		}},
+	{'b', "escape", "", false,
+		"write unprintable characters in names as C escapes",
+		func(arguments *Arguments, value string) error {
+			arguments.set_quoting("escape")
+			return nil
+		}},
+	{'c', "", "", false,
+		"like --time=ctime",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Time = "ctime"
+			return nil
+		}},
+	{'C', "", "", false,
+		"list entries in columns, even if not on a terminal",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("vertical")
+			return nil
+		}},
+	{'d', "directory", "", false,
+		"list directories like files",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Dir = true
+			return nil
+		}},
+	{'F', "classify", "WHEN", true,
+		"mark types with '/', '*', '@', '|' or '=' after names",
+		func(arguments *Arguments, value string) error {
+			when, err := parse_when(value, "classify")
+			if err != nil {
+				return err
+			}
+			if when == "never" {
+				arguments.set_indicator("")
+			} else {
+				arguments.set_indicator("classify")
+				arguments.classify = when == "auto"
+			}
+			return nil
+		}},
+	{'g', "", "", false,
+		"like -l, but without the owner",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("long")
+			arguments.options.NoOwner = true
+			return nil
+		}},
+	{'h', "human-readable", "", false,
+		"list sizes with human-readable units",
+		func(arguments *Arguments, value string) error {
+			arguments.set_units(listing.BlockSize{Human: true})
+			return nil
+		}},
+	{'i', "inode", "", false,
+		"print the inode number of each entry",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Inode = true
+			return nil
+		}},
+	{'k', "kibibytes", "", false,
+		"count blocks in units of 1024 bytes",
+		func(arguments *Arguments, value string) error {
+			arguments.kibibytes = true
+			return nil
+		}},
+	{'l', "", "", false,
+		"long listing",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("long")
+			return nil
+		}},
+	{'m', "", "", false,
+		"list entries separated by commas",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("commas")
+			return nil
+		}},
+	{'n', "numeric-uid-gid", "", false,
+		"like -l, but with numeric user and group ids",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("long")
+			arguments.options.NumericIDs = true
+			return nil
+		}},
+	{'N', "literal", "", false,
+		"write names without quoting them",
+		func(arguments *Arguments, value string) error {
+			arguments.set_quoting("literal")
+			return nil
+		}},
+	{'o', "", "", false,
+		"like -l, but without the group",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("long")
+			arguments.options.NoGroup = true
+			return nil
+		}},
+	{'p', "", "", false,
+		"mark directories with '/' after their names",
+		func(arguments *Arguments, value string) error {
+			arguments.set_indicator("slash")
+			return nil
+		}},
+	{'q', "hide-control-chars", "", false,
+		"write unprintable characters in names as '?'",
+		func(arguments *Arguments, value string) error {
+			arguments.options.HideControl = true
+			arguments.control_chars = "hide"
+			return nil
+		}},
+	{'r', "reverse", "", false,
+		"reverse any sorting",
+		func(arguments *Arguments, value string) error {
+			arguments.options.SortReverse = true
+			return nil
+		}},
+	{'R', "recursive", "", false,
+		"list subdirectories recursively",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Recursive = true
+			return nil
+		}},
+	{'s', "size", "", false,
+		"print the number of blocks allocated to each entry",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Blocks = true
+			return nil
+		}},
+	{'t', "", "", false,
+		"sort entries by modify time",
+		func(arguments *Arguments, value string) error {
+			arguments.options.SortTime = true
+			return nil
+		}},
+	{'S', "", "", false,
+		"sort entries by size",
+		func(arguments *Arguments, value string) error {
+			arguments.options.SortSize = true
+			return nil
+		}},
+	{'u', "", "", false,
+		"like --time=atime",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Time = "atime"
+			return nil
+		}},
+	{'w', "width", "COLS", false,
+		"assume the output is COLS wide, 0 for no limit",
+		func(arguments *Arguments, value string) error {
+			width, err := strconv.Atoi(value)
+			if err != nil || width < 0 {
+				return UsageError{
+					fmt.Sprintf("invalid line width: '%s'", value)}
+			}
+			arguments.width = width
+			return nil
+		}},
+	{'x', "", "", false,
+		"list entries in rows instead of columns",
+		func(arguments *Arguments, value string) error {
+			arguments.set_format("across")
+			return nil
+		}},
+	{'Z', "context", "", false,
+		"print the SELinux security context of each entry",
+		func(arguments *Arguments, value string) error {
+			arguments.options.Context = true
+			return nil
+		}},
+}
+
+// Use the given units for both the size column and the blocks of -s, as with
+// -h, --si and --block-size.
+func (arguments *Arguments) set_units(units listing.BlockSize) {
+	arguments.options.SizeUnits = units
+	arguments.options.BlockUnits = units
+	arguments.block_size = true
+}
+
+// Use the given layout, replacing any chosen by an earlier option.  The formats
+// are the canonical arguments of --format.
+func (arguments *Arguments) set_format(format string) {
+	arguments.options.Long = format == "long"
+	arguments.options.One = format == "single-column"
+	arguments.options.Across = format == "across"
+	arguments.options.Commas = format == "commas"
+	arguments.format = format
+}
+
+// Use the given quoting style, replacing any chosen by an earlier option or
+// QUOTING_STYLE.
+func (arguments *Arguments) set_quoting(style string) {
+	arguments.options.Quoting = style
+	arguments.quoting = true
+}
+
+// Use the given indicator style, replacing any chosen by an earlier option.
+func (arguments *Arguments) set_indicator(style string) {
+	arguments.options.Indicator = style
+	arguments.classify = false
+}
+
+// Parse the argument of --color, --classify or --hyperlink, accepting the same
+// synonyms as GNU ls.  With no argument, these options mean "always".
+func parse_when(value string, option string) (string, error) {
+	if value == "" || value == "always" || value == "yes" ||
+		value == "force" {
+		return "always", nil
+	} else if value == "never" || value == "no" || value == "none" {
+		return "never", nil
+	} else if value == "auto" || value == "tty" || value == "if-tty" {
+		return "auto", nil
+	}
+
+	return "", UsageError{
+		fmt.Sprintf("invalid argument '%s' for '--%s'", value, option)}
+}
+
+// Parse the argument of --format, accepting the same synonyms as GNU ls.
+func parse_format(value string) (string, error) {
+	if value == "across" || value == "horizontal" {
+		return "across", nil
+	} else if value == "long" || value == "verbose" {
+		return "long", nil
+	} else if value == "commas" || value == "single-column" ||
+		value == "vertical" {
+		return value, nil
+	}
+
+	return "", UsageError{
+		fmt.Sprintf("invalid argument '%s' for '--format'", value)}
+}
+
+// Parse the argument of --quoting-style, or the value of QUOTING_STYLE.  The
+// error is left for the caller to word.
+func parse_quoting_style(value string) (string, error) {
+	if value == "literal" || value == "shell" || value == "shell-always" ||
+		value == "shell-escape" || value == "shell-escape-always" ||
+		value == "c" || value == "escape" || value == "locale" {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid quoting style '%s'", value)
+}
+
+// Parse the argument of --time, accepting the same synonyms as GNU ls.  The
+// modification time is given as "", since it is the default.
+func parse_time_word(value string) (string, error) {
+	if value == "atime" || value == "access" || value == "use" {
+		return "atime", nil
+	} else if value == "ctime" || value == "status" {
+		return "ctime", nil
+	} else if value == "birth" || value == "creation" {
+		return "birth", nil
+	} else if value == "mtime" || value == "modification" {
+		return "", nil
+	}
+
+	return "", UsageError{
+		fmt.Sprintf("invalid argument '%s' for '--time'", value)}
+}
+
+// Parse the argument of --time-style.  As with GNU ls, a "posix-" prefix is
+// allowed, and since ls doesn't use locales it is simply dropped.
+func parse_time_style(value string) (string, error) {
+	if strings.HasPrefix(value, "+") {
+		return value, nil
+	}
+
+	time_style := strings.TrimPrefix(value, "posix-")
+	if time_style == "full-iso" || time_style == "long-iso" ||
+		time_style == "iso" || time_style == "locale" ||
+		time_style == "relative" {
+		return time_style, nil
+	}
+
+	return "", UsageError{
+		fmt.Sprintf("invalid argument '%s' for '--time-style'", value)}
+}
+
+// Parse the argument of --type, a comma-separated list of the letters used by
+// 'find -type': 'd' for directories, 'f' for regular files, 'l' for symlinks,
+// 'p' for named pipes, 's' for sockets, 'b' and 'c' for block and character
+// devices, and 'D' for doors.
+func parse_types(value string) (string, error) {
+	types := ""
+
+	for _, t := range strings.Split(value, ",") {
+		if len(t) != 1 || !strings.Contains("dflpsbcD", t) {
+			return "", UsageError{
+				fmt.Sprintf("invalid argument '%s' for '--type'", value)}
+		}
+		types += t
+	}
+
+	return types, nil
+}
+
+// Return the flags of the given option as shown by --help, e.g. "-a, --all" or
+// "    --color[=WHEN]".
+func option_flags(o Option) string {
+	var flags bytes.Buffer
+
+	if o.short != 0 {
+		flags.WriteString(fmt.Sprintf("-%c", o.short))
+		if o.long != "" {
+			flags.WriteString(", ")
+		} else if o.argument != "" {
+			flags.WriteString(" " + o.argument)
+		}
+	} else {
+		flags.WriteString("    ")
+	}
+
+	if o.long != "" {
+		flags.WriteString("--" + o.long)
+		if o.argument != "" && o.optional {
+			flags.WriteString("[=" + o.argument + "]")
+		} else if o.argument != "" {
+			flags.WriteString("=" + o.argument)
+		}
+	}
+
+	return flags.String()
+}
+
+// Generate the --help output from the option table.
+func help_text() string {
+	var help bytes.Buffer
+
+	width_flags := 0
+	for _, o := range option_table {
+		if len(option_flags(o)) > width_flags {
+			width_flags = len(option_flags(o))
+		}
+	}
+
+	help.WriteString("usage:  ls [OPTIONS] [FILES]\n\n")
+	help.WriteString("OPTIONS:\n")
+	for _, o := range option_table {
+		flags := option_flags(o)
+		help.WriteString("    " + flags)
+		help.WriteString(strings.Repeat(" ", width_flags-len(flags)+2))
+		help.WriteString(o.help + "\n")
+	}
+
+	return strings.TrimSuffix(help.String(), "\n")
+}
+
+// Find the option with the given long flag.  Like getopt_long, any unambiguous
+// prefix of a long flag is accepted.
+func find_long_option(name string) (Option, error) {
+	matches := make([]Option, 0)
+
+	for _, o := range option_table {
+		if o.long == "" {
+			continue
+		}
+		if o.long == name {
+			return o, nil
+		}
+		if strings.HasPrefix(o.long, name) {
+			matches = append(matches, o)
+		}
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	} else if len(matches) > 1 {
+		return Option{}, UsageError{
+			fmt.Sprintf("option '--%s' is ambiguous", name)}
+	}
+
+	return Option{}, UsageError{
+		fmt.Sprintf("unrecognized option '--%s'", name)}
+}
+
+// Find the option with the given short flag.
+func find_short_option(flag rune) (Option, error) {
+	for _, o := range option_table {
+		if o.short == flag {
+			return o, nil
+		}
+	}
+
+	return Option{}, UsageError{fmt.Sprintf("invalid option -- '%c'", flag)}
+}
+
+// Parse the program arguments in the style of GNU getopt_long.  Short flags may
+// be bundled ("-la"), long flags take their arguments as "--name=value" or
+// "--name value", and options may come before or after the files.  Everything
+// after a "--" is treated as a file.
+func parse_args(args []string) (Arguments, error) {
+	arguments := Arguments{
+		width: -1,
+		files: make([]string, 0),
+	}
+
+	end_of_options := false
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+
+		// "-" on its own is a file name, not an option
+		if end_of_options || len(a) < 2 || a[0] != '-' {
+			arguments.files = append(arguments.files, a)
+			continue
+		}
+
+		if a == "--" {
+			end_of_options = true
+			continue
+		}
+
+		// long option
+		if strings.HasPrefix(a, "--") {
+			name := a[2:]
+			value := ""
+			has_value := false
+			if index := strings.Index(name, "="); index != -1 {
+				name, value = name[:index], name[index+1:]
+				has_value = true
+			}
+
+			o, err := find_long_option(name)
+			if err != nil {
+				return arguments, err
+			}
+
+			if o.argument == "" && has_value {
+				return arguments, UsageError{fmt.Sprintf(
+					"option '--%s' doesn't allow an argument", o.long)}
+			} else if o.argument != "" && !has_value && !o.optional {
+				if i+1 >= len(args) {
+					return arguments, UsageError{fmt.Sprintf(
+						"option '--%s' requires an argument", o.long)}
+				}
+				i++
+				value = args[i]
+			}
+
+			err = o.apply(&arguments, value)
+			if err != nil {
+				return arguments, err
+			}
+			continue
+		}
+
+		// bundle of short options
+		flags := []rune(a[1:])
+		for j, flag := range flags {
+			o, err := find_short_option(flag)
+			if err != nil {
+				return arguments, err
+			}
+
+			// as with GNU ls, an optional argument can only be given to
+			// the long flag, so "-Fp" is "-F -p"
+			if o.argument == "" || o.optional {
+				err = o.apply(&arguments, "")
+				if err != nil {
+					return arguments, err
+				}
+				continue
+			}
+
+			// the rest of the bundle, or else the next program argument, is
+			// the option's argument
+			value := string(flags[j+1:])
+			if value == "" {
+				if i+1 >= len(args) {
+					return arguments, UsageError{fmt.Sprintf(
+						"option requires an argument -- '%c'", flag)}
+				}
+				i++
+				value = args[i]
+			}
+
+			err = o.apply(&arguments, value)
+			if err != nil {
+				return arguments, err
+			}
+			break
+		}
+	}
+
+	// as with GNU ls, choosing a timestamp without -l also sorts by it
+	if arguments.options.Time != "" && !arguments.options.Long {
+		arguments.options.SortTime = true
+	}
+
+	return arguments, nil
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
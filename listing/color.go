@@ -0,0 +1,533 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Base set of color codes for colorized output
+const (
+	color_fg_black   = 30
+	color_fg_red     = 31
+	color_fg_green   = 32
+	color_fg_brown   = 33
+	color_fg_blue    = 34
+	color_fg_magenta = 35
+	color_fg_cyan    = 36
+	color_fg_white   = 37
+	color_bg_black   = 40
+	color_bg_red     = 41
+	color_bg_green   = 42
+	color_bg_brown   = 43
+	color_bg_blue    = 44
+	color_bg_magenta = 45
+	color_bg_cyan    = 46
+	color_bg_white   = 47
+)
+
+// The colors used when neither LSCOLORS or LS_COLORS is set.
+const DefaultLSCOLORS = "exfxcxdxbxegedabagacad"
+
+// Helper function for get_color_from_bsd_code.  Given a flag to indicate
+// foreground/background and a single letter, return the correct partial ASCII
+// color code.
+func get_partial_color(foreground bool, letter uint8) string {
+	var partial_bytes bytes.Buffer
+
+	if foreground && letter == 'x' {
+		partial_bytes.WriteString("0;")
+	} else if !foreground && letter != 'x' {
+		partial_bytes.WriteString(";")
+	}
+
+	if foreground && letter >= 97 && letter <= 122 {
+		partial_bytes.WriteString("0;")
+	} else if foreground && letter >= 65 && letter <= 90 {
+		partial_bytes.WriteString("1;")
+	}
+
+	if letter == 'a' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_black))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_black))
+		}
+	} else if letter == 'b' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_red))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_red))
+		}
+	} else if letter == 'c' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_green))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_green))
+		}
+	} else if letter == 'd' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_brown))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_brown))
+		}
+	} else if letter == 'e' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_blue))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_blue))
+		}
+	} else if letter == 'f' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_magenta))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_magenta))
+		}
+	} else if letter == 'g' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_cyan))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_cyan))
+		}
+	} else if letter == 'h' {
+		if foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_fg_white))
+		} else if !foreground {
+			partial_bytes.WriteString(strconv.Itoa(color_bg_white))
+		}
+	} else if letter == 'A' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_black))
+	} else if letter == 'B' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_red))
+	} else if letter == 'C' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_green))
+	} else if letter == 'D' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_brown))
+	} else if letter == 'E' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_blue))
+	} else if letter == 'F' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_magenta))
+	} else if letter == 'G' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_cyan))
+	} else if letter == 'H' {
+		partial_bytes.WriteString(strconv.Itoa(color_fg_white))
+	}
+
+	return partial_bytes.String()
+}
+
+// Given a BSD LSCOLORS code like "ex", return the proper ASCII code
+// (like "\x1b[0;32m")
+func get_color_from_bsd_code(code string) string {
+	color_foreground := code[0]
+	color_background := code[1]
+
+	var color_bytes bytes.Buffer
+	color_bytes.WriteString("\x1b[")
+	color_bytes.WriteString(get_partial_color(true, color_foreground))
+	color_bytes.WriteString(get_partial_color(false, color_background))
+	color_bytes.WriteString("m")
+
+	return color_bytes.String()
+}
+
+// The color_map keys of the file types in LSCOLORS, in the order their pairs of
+// letters appear.
+var types_LSCOLORS = []string{
+	"directory",
+	"symlink",
+	"socket",
+	"pipe",
+	"executable",
+	"block",
+	"character",
+	"executable_suid",
+	"executable_sgid",
+	"directory_o+w_sticky",
+	"directory_o+w",
+}
+
+// Given an LSCOLORS string, fill in the appropriate keys and values of the
+// Lister's color_map.
+func (lister *Lister) parse_LSCOLORS(LSCOLORS string) {
+	if len(LSCOLORS)%2 != 0 {
+		lister.color_errors = append(lister.color_errors,
+			fmt.Errorf("malformed LSCOLORS '%s'", LSCOLORS))
+		LSCOLORS = LSCOLORS[:len(LSCOLORS)-1]
+	}
+
+	for i, key := range types_LSCOLORS {
+		if 2*i+2 > len(LSCOLORS) {
+			break
+		}
+		lister.color_map[key] = get_color_from_bsd_code(LSCOLORS[2*i : 2*i+2])
+	}
+}
+
+// The color_map keys of the two-letter file types in LS_COLORS.  The "left",
+// "right" and "end" codes wrap every color, and "reset" is used to end them if
+// no "end" code is given.
+var types_LS_COLORS = map[string]string{
+	"lc": "left",
+	"rc": "right",
+	"ec": "end",
+	"rs": "reset",
+	"no": "normal",
+	"fi": "file",
+	"di": "directory",
+	"ln": "symlink",
+	"mh": "multi_hardlink",
+	"pi": "pipe",
+	"so": "socket",
+	"do": "door",
+	"bd": "block",
+	"cd": "character",
+	"or": "link_orphan",
+	"mi": "link_orphan_target",
+	"su": "executable_suid",
+	"sg": "executable_sgid",
+	"ca": "capability",
+	"tw": "directory_o+w_sticky",
+	"ow": "directory_o+w",
+	"st": "directory_sticky",
+	"ex": "executable",
+}
+
+// Return the index of the first sep in s that isn't escaped by a backslash, or
+// -1 if there is none.
+func index_unescaped(s string, sep byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+		} else if s[i] == sep {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Expand the escapes in an LS_COLORS key or value, as dircolors writes them:
+// backslash escapes such as "\e", "\033" or "\x1b", and caret notation such as
+// "^[".
+func unescape_LS_COLORS(s string) (string, error) {
+	var unescaped bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '^' {
+			i++
+			if i >= len(s) {
+				return "", fmt.Errorf("trailing '^'")
+			} else if s[i] == '?' {
+				unescaped.WriteByte(127)
+			} else if s[i] >= '@' && s[i] <= '~' {
+				unescaped.WriteByte(s[i] & 0x1f)
+			} else {
+				return "", fmt.Errorf("invalid control character '^%c'", s[i])
+			}
+			continue
+		} else if s[i] != '\\' {
+			unescaped.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("trailing '\\'")
+		}
+
+		// octal and hexadecimal escapes
+		escape_start := i - 1
+		base, digits, max_digits := 0, "", 0
+		if s[i] >= '0' && s[i] <= '7' {
+			base, digits, max_digits = 8, "01234567", 3
+		} else if s[i] == 'x' {
+			base, digits, max_digits = 16, "0123456789abcdefABCDEF", 2
+			i++
+		}
+		if base != 0 {
+			j := i
+			for j < len(s) && j-i < max_digits &&
+				strings.IndexByte(digits, s[j]) != -1 {
+				j++
+			}
+			value, err := strconv.ParseUint(s[i:j], base, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape '%s'",
+					s[escape_start:j])
+			}
+			unescaped.WriteByte(byte(value))
+			i = j - 1
+			continue
+		}
+
+		switch s[i] {
+		case 'a':
+			unescaped.WriteByte('\a')
+		case 'b':
+			unescaped.WriteByte('\b')
+		case 'e':
+			unescaped.WriteByte(0x1b)
+		case 'f':
+			unescaped.WriteByte('\f')
+		case 'n':
+			unescaped.WriteByte('\n')
+		case 'r':
+			unescaped.WriteByte('\r')
+		case 't':
+			unescaped.WriteByte('\t')
+		case 'v':
+			unescaped.WriteByte('\v')
+		case '?':
+			unescaped.WriteByte(127)
+		case '_':
+			unescaped.WriteByte(' ')
+		default:
+			unescaped.WriteByte(s[i])
+		}
+	}
+
+	return unescaped.String(), nil
+}
+
+// Split an LS_COLORS string into its codes, keyed by the names used in the
+// color_map.  Each entry is either one of the two-letter file types, or a
+// "*suffix" rule for names ending in that suffix.  Malformed entries are
+// returned as errors and skipped.
+func read_LS_COLORS(LS_COLORS string) (map[string]string, []error) {
+	codes := make(map[string]string)
+	errors := make([]error, 0)
+
+	for len(LS_COLORS) > 0 {
+		entry := LS_COLORS
+		if i := index_unescaped(LS_COLORS, ':'); i != -1 {
+			entry, LS_COLORS = LS_COLORS[:i], LS_COLORS[i+1:]
+		} else {
+			LS_COLORS = ""
+		}
+		if entry == "" {
+			continue
+		}
+
+		i := index_unescaped(entry, '=')
+		if i == -1 {
+			errors = append(errors,
+				fmt.Errorf("malformed LS_COLORS entry '%s'", entry))
+			continue
+		}
+
+		key, err := unescape_LS_COLORS(entry[:i])
+		code := ""
+		if err == nil {
+			code, err = unescape_LS_COLORS(entry[i+1:])
+		}
+		if err != nil {
+			errors = append(errors,
+				fmt.Errorf("malformed LS_COLORS entry '%s': %v", entry, err))
+			continue
+		}
+
+		if strings.HasPrefix(key, "*") && len(key) > 1 {
+			codes[key] = code
+		} else if types_LS_COLORS[key] != "" {
+			codes[types_LS_COLORS[key]] = code
+		} else {
+			errors = append(errors,
+				fmt.Errorf("unrecognized LS_COLORS entry '%s'", entry))
+		}
+	}
+
+	return codes, errors
+}
+
+// Given an LS_COLORS string, fill in the appropriate keys and values of the
+// Lister's color_map.  Malformed entries are recorded in the Lister's
+// color_errors and skipped.
+func (lister *Lister) parse_LS_COLORS(LS_COLORS string) {
+	codes, errors := read_LS_COLORS(LS_COLORS)
+	lister.color_errors = append(lister.color_errors, errors...)
+
+	for key, code := range map[string]string{
+		"left":  "\x1b[",
+		"right": "m",
+		"reset": "0",
+	} {
+		if _, ok := codes[key]; !ok {
+			codes[key] = code
+		}
+	}
+
+	for key, code := range codes {
+		if key == "left" || key == "right" || key == "reset" || key == "end" {
+			continue
+		}
+
+		// "ln=target" colors symlinks like the files they point to, rather
+		// than in a color of their own
+		if key == "symlink" && code == "target" {
+			lister.color_target = true
+			continue
+		}
+
+		// like dircolors, treat "0" and "00" as no color at all, so that the
+		// next most specific file type is used instead
+		if code == "" || code == "0" || code == "00" {
+			continue
+		}
+
+		lister.color_map[key] = codes["left"] + code + codes["right"]
+	}
+
+	if end, ok := codes["end"]; ok {
+		lister.color_map["end"] = end
+	} else {
+		lister.color_map["end"] =
+			codes["left"] + codes["reset"] + codes["right"]
+	}
+}
+
+// Return the two-letter LS_COLORS code of the given color_map key, such as "di"
+// for "directory", or "" if it isn't a file type.
+func type_code_LS_COLORS(key string) string {
+	for code, type_key := range types_LS_COLORS {
+		if type_key == key {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// Return the SGR codes for a pair of BSD LSCOLORS letters, e.g. "Ex" gives
+// "01;34".  "xx" has no color at all, and gives "0".
+func bsd_code_to_sgr(code string) string {
+	parts := make([]string, 0)
+	foreground, background := code[0], code[1]
+
+	if foreground >= 'A' && foreground <= 'H' {
+		parts = append(parts, "01",
+			strconv.Itoa(color_fg_black+int(foreground-'A')))
+	} else if foreground >= 'a' && foreground <= 'h' {
+		parts = append(parts, strconv.Itoa(color_fg_black+int(foreground-'a')))
+	}
+
+	if background >= 'A' && background <= 'H' {
+		background += 'a' - 'A'
+	}
+	if background >= 'a' && background <= 'h' {
+		parts = append(parts, strconv.Itoa(color_bg_black+int(background-'a')))
+	}
+
+	if len(parts) == 0 {
+		return "0"
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Return the pair of BSD LSCOLORS letters closest to the given SGR codes, e.g.
+// "01;34" gives "Ex".  LSCOLORS only has the eight basic colors and bold, so
+// other attributes are dropped and bright colors become bold ones.
+func sgr_to_bsd_code(sgr string) string {
+	foreground, background := byte('x'), byte('x')
+	bold := false
+
+	params := strings.Split(sgr, ";")
+	for i := 0; i < len(params); i++ {
+		n := 0
+		if params[i] != "" {
+			var err error
+			n, err = strconv.Atoi(params[i])
+			if err != nil {
+				continue
+			}
+		}
+
+		if n == 0 {
+			foreground, background, bold = 'x', 'x', false
+		} else if n == 1 {
+			bold = true
+		} else if n >= 30 && n <= 37 {
+			foreground = byte('a' + n - 30)
+		} else if n == 39 {
+			foreground = 'x'
+		} else if n >= 40 && n <= 47 {
+			background = byte('a' + n - 40)
+		} else if n == 49 {
+			background = 'x'
+		} else if n >= 90 && n <= 97 {
+			foreground = byte('a' + n - 90)
+			bold = true
+		} else if n >= 100 && n <= 107 {
+			background = byte('a' + n - 100)
+		} else if (n == 38 || n == 48) && i+1 < len(params) {
+			// skip the arguments of 256-color and 24-bit color codes
+			if params[i+1] == "5" {
+				i += 2
+			} else if params[i+1] == "2" {
+				i += 4
+			}
+		}
+	}
+
+	if bold && foreground != 'x' {
+		foreground -= 'a' - 'A'
+	}
+
+	return string([]byte{foreground, background})
+}
+
+// Convert a BSD LSCOLORS string to the equivalent GNU LS_COLORS string.
+func BSDToGNUColors(LSCOLORS string) string {
+	var LS_COLORS bytes.Buffer
+
+	for i, key := range types_LSCOLORS {
+		if 2*i+2 > len(LSCOLORS) {
+			break
+		}
+		LS_COLORS.WriteString(fmt.Sprintf("%s=%s:", type_code_LS_COLORS(key),
+			bsd_code_to_sgr(LSCOLORS[2*i:2*i+2])))
+	}
+
+	return LS_COLORS.String()
+}
+
+// Convert a GNU LS_COLORS string to the closest BSD LSCOLORS string.  Only the
+// eleven file types that LSCOLORS has are kept, and those without a color in
+// LS_COLORS are given the terminal's default colors ("xx").  Malformed
+// entries are skipped.
+func GNUToBSDColors(LS_COLORS string) string {
+	var LSCOLORS bytes.Buffer
+
+	codes, _ := read_LS_COLORS(LS_COLORS)
+	for _, key := range types_LSCOLORS {
+		LSCOLORS.WriteString(sgr_to_bsd_code(codes[key]))
+	}
+
+	return LSCOLORS.String()
+}
+
+// Fill in the Lister's color_map from the LSCOLORS or LS_COLORS options, in
+// that order, falling back on the default LSCOLORS setting if neither is set.
+func (lister *Lister) setup_colors() {
+	lister.color_map = make(map[string]string)
+	lister.color_map["end"] = "\x1b[0m"
+
+	if lister.options.LSCOLORS != "" {
+		lister.parse_LSCOLORS(lister.options.LSCOLORS)
+	} else if lister.options.LS_COLORS != "" {
+		lister.parse_LS_COLORS(lister.options.LS_COLORS)
+	} else {
+		lister.parse_LSCOLORS(DefaultLSCOLORS)
+	}
+}
+
+// Return the problems found in the LSCOLORS or LS_COLORS options when the
+// Lister was created.  The malformed entries are ignored, and the rest of the
+// colors are still used.
+func (lister *Lister) ColorErrors() []error {
+	return lister.color_errors
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,146 @@
+package listing
+
+import (
+	"testing"
+)
+
+// Test expanding the backslash and caret escapes of LS_COLORS
+func Test_unescape_LS_COLORS(t *testing.T) {
+	escapes := map[string]string{
+		"01;34":     "01;34",
+		"\\e[":      "\x1b[",
+		"\\033[":    "\x1b[",
+		"\\x1b[":    "\x1b[",
+		"^[[":       "\x1b[",
+		"\\_\\:\\=": " :=",
+		"a\\tb\\?":  "a\tb\x7f",
+	}
+
+	for escaped, expected := range escapes {
+		unescaped, err := unescape_LS_COLORS(escaped)
+		if err != nil {
+			t.Logf("unescape_LS_COLORS(%q): %v", escaped, err)
+			t.Fail()
+		}
+		check_output(t, unescaped, expected)
+	}
+
+	for _, escaped := range []string{"01;34\\", "^", "^1", "\\x"} {
+		_, err := unescape_LS_COLORS(escaped)
+		if err == nil {
+			t.Logf("unescape_LS_COLORS(%q) should fail", escaped)
+			t.Fail()
+		}
+	}
+}
+
+// Test that malformed LS_COLORS entries are reported and skipped, without
+// affecting the rest
+func Test_parse_LS_COLORS_Malformed(t *testing.T) {
+	lister := &Lister{color_map: make(map[string]string)}
+
+	lister.parse_LS_COLORS("di=01;34:bogus:xx=01:ln=01;36\\:ex=\\")
+
+	check_output(t, lister.color_map["directory"], "\x1b[01;34m")
+	check_output(t, lister.color_map["symlink"], "")
+	check_output(t, lister.color_map["end"], "\x1b[0m")
+
+	if len(lister.ColorErrors()) != 3 {
+		t.Logf("expected 3 color errors, got %v", lister.ColorErrors())
+		t.Fail()
+	}
+}
+
+// Test the lc, rc and ec codes that wrap each color
+func Test_parse_LS_COLORS_Wrappers(t *testing.T) {
+	lister := &Lister{color_map: make(map[string]string)}
+
+	lister.parse_LS_COLORS("lc=\\e[1;:rc=m!:ec=\\e[m:di=34:fi=00:no=0")
+
+	check_output(t, lister.color_map["directory"], "\x1b[1;34m!")
+	check_output(t, lister.color_map["end"], "\x1b[m")
+	check_output(t, lister.color_map["file"], "")
+	check_output(t, lister.color_map["normal"], "")
+}
+
+// Test that "*suffix" rules use the longest match, ignoring case unless there
+// is an exact match
+func Test_match_suffix(t *testing.T) {
+	lister := &Lister{color_map: make(map[string]string)}
+
+	lister.parse_LS_COLORS("*.gz=31:*.tar.gz=32:*.Z=33:*.z=34:*README=35")
+
+	suffixes := map[string]string{
+		"a.gz":        "*.gz",
+		"a.tar.gz":    "*.tar.gz",
+		"a.TAR.GZ":    "*.tar.gz",
+		"a.Z":         "*.Z",
+		"a.z":         "*.z",
+		"README":      "*README",
+		"SUB.readme":  "*README",
+		"a.tar":       "",
+		"a.tar.gz.gz": "*.gz",
+	}
+
+	for name, expected := range suffixes {
+		check_output(t, lister.match_suffix(name), expected)
+	}
+}
+
+// Test the order in which file types are colored, like GNU ls
+func Test_listing_color(t *testing.T) {
+	lister := &Lister{
+		options:   Options{Color: true},
+		color_map: make(map[string]string),
+	}
+
+	lister.parse_LS_COLORS("fi=1:ex=2:ca=3:mh=4:*.tar=5:di=6:no=7")
+
+	listings := map[string]Listing{
+		"1": {Permissions: "-rw-r--r--", Name: "a"},
+		"2": {Permissions: "-rwxr-xr-x", Name: "a.tar", NumHardLinks: 2},
+		"3": {Permissions: "-rwxr-xr-x", Name: "a", Capability: true},
+		"4": {Permissions: "-rw-r--r--", Name: "a.tar", NumHardLinks: 2},
+		"5": {Permissions: "-rw-r--r--", Name: "a.TAR"},
+		"6": {Permissions: "drwxr-xr-x", Name: "a.tar"},
+		"7": {Permissions: "prw-r--r--", Name: "a", IsPipe: true},
+	}
+
+	for code, l := range listings {
+		check_output(t, lister.listing_color(l), "\x1b["+code+"m")
+	}
+}
+
+// Test converting between BSD LSCOLORS letters and GNU SGR codes
+func Test_bsd_code_sgr(t *testing.T) {
+	codes := map[string]string{
+		"ex": "34",
+		"Ex": "01;34",
+		"ab": "30;41",
+		"xg": "46",
+		"xx": "0",
+	}
+
+	for bsd_code, sgr := range codes {
+		check_output(t, bsd_code_to_sgr(bsd_code), sgr)
+		check_output(t, sgr_to_bsd_code(sgr), bsd_code)
+	}
+
+	check_output(t, sgr_to_bsd_code("01;94;38;5;100;49"), "Ex")
+	check_output(t, sgr_to_bsd_code("04;32;0;41"), "xb")
+}
+
+// Test that converting LSCOLORS to LS_COLORS and back gives the same colors
+func Test_BSDToGNUColors_RoundTrip(t *testing.T) {
+	LS_COLORS := BSDToGNUColors(DefaultLSCOLORS)
+
+	check_output(t, LS_COLORS, "di=34:ln=35:so=32:pi=33:ex=31:bd=34;46:"+
+		"cd=34;43:su=30;41:sg=30;46:tw=30;42:ow=30;43:")
+	check_output(t, GNUToBSDColors(LS_COLORS), DefaultLSCOLORS)
+
+	// file types missing from LS_COLORS get the default colors
+	check_output(t, GNUToBSDColors("ex=01;32:di=01;34:*.tar=31"),
+		"ExxxxxxxCxxxxxxxxxxxxx")
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,13 @@
+package listing
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Split a device number into its major and minor numbers, as encoded by the
+// system the program is running on.
+func device_numbers(rdev uint64) (uint64, uint64) {
+	return uint64(unix.Major(rdev)), uint64(unix.Minor(rdev))
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,176 @@
+package listing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// The colors read from a dircolors database by ReadDircolors.
+type Dircolors struct {
+	LS_COLORS string  // the colors for the terminal, as an LS_COLORS string
+	Color     string  // "all", "tty" or "none" from COLOR, or "" if not given
+	Errors    []error // problems with the lines that were skipped
+}
+
+// The two-letter LS_COLORS codes of the file type keywords in a dircolors
+// database, including the older spellings that dircolors still accepts.
+var dircolors_keywords = map[string]string{
+	"NORMAL":                "no",
+	"NORM":                  "no",
+	"FILE":                  "fi",
+	"RESET":                 "rs",
+	"DIR":                   "di",
+	"LNK":                   "ln",
+	"LINK":                  "ln",
+	"SYMLINK":               "ln",
+	"ORPHAN":                "or",
+	"MISSING":               "mi",
+	"FIFO":                  "pi",
+	"PIPE":                  "pi",
+	"SOCK":                  "so",
+	"BLK":                   "bd",
+	"BLOCK":                 "bd",
+	"CHR":                   "cd",
+	"CHAR":                  "cd",
+	"DOOR":                  "do",
+	"EXEC":                  "ex",
+	"LEFT":                  "lc",
+	"LEFTCODE":              "lc",
+	"RIGHT":                 "rc",
+	"RIGHTCODE":             "rc",
+	"END":                   "ec",
+	"ENDCODE":               "ec",
+	"SUID":                  "su",
+	"SETUID":                "su",
+	"SGID":                  "sg",
+	"SETGID":                "sg",
+	"STICKY":                "st",
+	"OTHER_WRITABLE":        "ow",
+	"OWR":                   "ow",
+	"STICKY_OTHER_WRITABLE": "tw",
+	"OWT":                   "tw",
+	"CAPABILITY":            "ca",
+	"MULTIHARDLINK":         "mh",
+}
+
+// Split a line of a dircolors database into its keyword and argument, dropping
+// any comment.  As with dircolors, a '#' only starts a comment at the start of
+// the line or in the argument, so keywords such as "*#" can be colored.  Blank
+// lines give an empty keyword.
+func split_dircolors_line(line string) (string, string) {
+	line = strings.TrimLeft(line, " \t")
+	if line == "" || line[0] == '#' {
+		return "", ""
+	}
+
+	keyword, argument := line, ""
+	if i := strings.IndexAny(line, " \t"); i != -1 {
+		keyword, argument = line[:i], line[i:]
+	}
+	if i := strings.Index(argument, "#"); i != -1 {
+		argument = argument[:i]
+	}
+
+	return keyword, strings.TrimSpace(argument)
+}
+
+// Read a dircolors database, such as /etc/DIR_COLORS, and return the colors it
+// gives for the terminal named by term (i.e. $TERM) and colorterm (i.e.
+// $COLORTERM).  As with dircolors, the lines before the first TERM or
+// COLORTERM line apply to every terminal, and the rest only apply if one of
+// the globs in the most recent group of TERM and COLORTERM lines matches.
+// The name of the database is only used in error messages, and lines that
+// can't be understood are returned in Errors and skipped.
+func ReadDircolors(input io.Reader, name, term, colorterm string) (
+	Dircolors, error) {
+
+	dircolors := Dircolors{Errors: make([]error, 0)}
+
+	if term == "" {
+		term = "none"
+	}
+
+	// whether the current group of TERM lines has matched, and whether the
+	// next TERM line starts a new group
+	matched := true
+	in_term_group := false
+
+	var LS_COLORS bytes.Buffer
+
+	scanner := bufio.NewScanner(input)
+	for line_number := 1; scanner.Scan(); line_number++ {
+		keyword, argument := split_dircolors_line(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		if argument == "" {
+			dircolors.Errors = append(dircolors.Errors, fmt.Errorf(
+				"%s:%d: missing argument for '%s'", name, line_number,
+				keyword))
+			continue
+		}
+
+		upper_keyword := strings.ToUpper(keyword)
+
+		if upper_keyword == "TERM" || upper_keyword == "COLORTERM" {
+			if !in_term_group {
+				matched = false
+				in_term_group = true
+			}
+
+			value := term
+			if upper_keyword == "COLORTERM" {
+				value = colorterm
+			}
+			if match, _ := filepath.Match(argument, value); match {
+				matched = true
+			}
+			continue
+		}
+		in_term_group = false
+
+		if !matched {
+			continue
+		}
+
+		if upper_keyword == "COLOR" {
+			argument = strings.ToLower(argument)
+			if argument != "all" && argument != "tty" && argument != "none" {
+				dircolors.Errors = append(dircolors.Errors, fmt.Errorf(
+					"%s:%d: invalid argument '%s' for 'COLOR'", name,
+					line_number, argument))
+				continue
+			}
+			dircolors.Color = argument
+		} else if upper_keyword == "OPTIONS" ||
+			upper_keyword == "EIGHTBIT" || upper_keyword == "CLRTOEOL" {
+			// settings from older databases, which don't apply to this ls
+			continue
+		} else if strings.HasPrefix(keyword, ".") {
+			LS_COLORS.WriteString(fmt.Sprintf("*%s=%s:", keyword, argument))
+		} else if strings.HasPrefix(keyword, "*") {
+			LS_COLORS.WriteString(fmt.Sprintf("%s=%s:", keyword, argument))
+		} else if code, ok := dircolors_keywords[upper_keyword]; ok {
+			LS_COLORS.WriteString(fmt.Sprintf("%s=%s:", code, argument))
+		} else {
+			dircolors.Errors = append(dircolors.Errors, fmt.Errorf(
+				"%s:%d: unrecognized keyword '%s'", name, line_number,
+				keyword))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return dircolors, fmt.Errorf("error reading %s: %v", name, err)
+	}
+
+	dircolors.LS_COLORS = LS_COLORS.String()
+
+	return dircolors, nil
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,58 @@
+package listing
+
+import (
+	"strings"
+	"testing"
+)
+
+// A small dircolors database, with global settings and two groups of TERM
+// lines
+const test_dircolors = `# global settings
+COLOR tty
+DIR 01;34 # directories
+.tar 01;31
+*# 00;90
+    # an indented comment
+
+TERM xterm*
+TERM screen
+LINK 01;36
+*README 33
+
+COLORTERM ?*
+EXEC 01;32
+bogus 1
+ORPHAN
+`
+
+// Test reading a dircolors database for a matching and a non-matching terminal
+func Test_ReadDircolors(t *testing.T) {
+	dircolors, err := ReadDircolors(strings.NewReader(test_dircolors),
+		"test", "xterm-256color", "")
+	if err != nil {
+		t.Fatalf("ReadDircolors: %v", err)
+	}
+
+	check_output(t, dircolors.LS_COLORS,
+		"di=01;34:*.tar=01;31:*#=00;90:ln=01;36:*README=33:")
+	check_output(t, dircolors.Color, "tty")
+
+	dircolors, err = ReadDircolors(strings.NewReader(test_dircolors),
+		"test", "linux", "truecolor")
+	if err != nil {
+		t.Fatalf("ReadDircolors: %v", err)
+	}
+
+	check_output(t, dircolors.LS_COLORS,
+		"di=01;34:*.tar=01;31:*#=00;90:ex=01;32:")
+
+	errors := make([]string, 0)
+	for _, e := range dircolors.Errors {
+		errors = append(errors, e.Error())
+	}
+	check_output(t, strings.Join(errors, "\n"),
+		"test:15: unrecognized keyword 'bogus'\n"+
+			"test:16: missing argument for 'ORPHAN'")
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
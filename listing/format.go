@@ -0,0 +1,780 @@
+package listing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Return the color_map key of the longest "*suffix" rule that matches the given
+// name, or "" if there is none.  As with GNU ls, suffixes are matched ignoring
+// case, though a rule that matches exactly is preferred over one that only
+// differs in case.
+func (lister *Lister) match_suffix(name string) string {
+	name_lower := strings.ToLower(name)
+
+	best_key := ""
+	best_exact := false
+	for key := range lister.color_map {
+		if !strings.HasPrefix(key, "*") {
+			continue
+		}
+
+		suffix := key[1:]
+		if !strings.HasSuffix(name_lower, strings.ToLower(suffix)) {
+			continue
+		}
+
+		// ties between rules are broken by the key itself, so that the result
+		// doesn't depend on the order of the map
+		exact := strings.HasSuffix(name, suffix)
+		if best_key == "" || len(key) > len(best_key) ||
+			(len(key) == len(best_key) && exact && !best_exact) ||
+			(len(key) == len(best_key) && exact == best_exact &&
+				key < best_key) {
+			best_key = key
+			best_exact = exact
+		}
+	}
+
+	return best_key
+}
+
+// Return the color to write the given Listing's name in, or "" for none.  As
+// with GNU ls, the most specific file type with a color set is used, and
+// "*suffix" rules only apply to regular files without a more specific type.
+// With "ln=target", symlinks are colored like their targets.
+func (lister *Lister) listing_color(l Listing) string {
+	if l.link_target != nil {
+		return lister.listing_color(*l.link_target)
+	}
+
+	keys := make([]string, 0)
+
+	if l.Permissions[0] == 'd' {
+		other_writable := l.Permissions[8] == 'w'
+		sticky := l.Permissions[9] == 't' || l.Permissions[9] == 'T'
+		if other_writable && sticky {
+			keys = append(keys, "directory_o+w_sticky")
+		}
+		if other_writable {
+			keys = append(keys, "directory_o+w")
+		}
+		if sticky {
+			keys = append(keys, "directory_sticky")
+		}
+		keys = append(keys, "directory")
+	} else if l.Permissions[0] == 'l' {
+		if l.LinkOrphan {
+			keys = append(keys, "link_orphan")
+		}
+		keys = append(keys, "symlink")
+	} else if l.IsSocket {
+		keys = append(keys, "socket")
+	} else if l.IsPipe {
+		keys = append(keys, "pipe")
+	} else if l.IsBlock {
+		keys = append(keys, "block")
+	} else if l.IsCharacter {
+		keys = append(keys, "character")
+	} else if l.IsDoor {
+		keys = append(keys, "door")
+	} else {
+		if l.Permissions[3] == 's' || l.Permissions[3] == 'S' {
+			keys = append(keys, "executable_suid")
+		}
+		if l.Permissions[6] == 's' || l.Permissions[6] == 'S' {
+			keys = append(keys, "executable_sgid")
+		}
+		if l.Capability {
+			keys = append(keys, "capability")
+		}
+		if strings.ContainsAny(l.Permissions[1:], "xst") {
+			keys = append(keys, "executable")
+		}
+		if l.NumHardLinks > 1 {
+			keys = append(keys, "multi_hardlink")
+		}
+		if suffix_key := lister.match_suffix(l.Name); suffix_key != "" {
+			keys = append(keys, suffix_key)
+		}
+		keys = append(keys, "file")
+	}
+	keys = append(keys, "normal")
+
+	for _, key := range keys {
+		if lister.color_map[key] != "" {
+			return lister.color_map[key]
+		}
+	}
+
+	return ""
+}
+
+// Return the character that marks the type of the given Listing after its name,
+// as selected by Options.Indicator, or "" for none.  As with GNU ls, symlinks
+// aren't marked in the long format, where they are followed by their targets.
+func (lister *Lister) indicator(l Listing) string {
+	style := lister.options.Indicator
+	if style == "" {
+		return ""
+	}
+
+	if l.Permissions[0] == 'd' {
+		return "/"
+	} else if style == "slash" {
+		return ""
+	}
+
+	if l.Permissions[0] == 'l' && !lister.options.Long {
+		return "@"
+	} else if l.IsPipe {
+		return "|"
+	} else if l.IsSocket {
+		return "="
+	} else if l.IsDoor {
+		return ">"
+	} else if style == "classify" && l.Permissions[0] == '-' &&
+		strings.ContainsAny(l.Permissions[1:10], "xst") {
+		return "*"
+	}
+
+	return ""
+}
+
+// Return the number of columns taken by the given Listing's name in the short
+// formats, including its indicator.
+func (lister *Lister) name_width(l Listing) int {
+	return display_width(lister.quote(l.Name)) + len(lister.indicator(l))
+}
+
+// Write the given Listing's name to the output buffer, quoted in the Lister's
+// quoting style, and in its color if the Lister has colors.  With hyperlinks,
+// the name is also linked to its file, which takes no more columns.
+func (lister *Lister) write_colored_name(output_buffer *bytes.Buffer,
+	l Listing) {
+
+	hyperlink := lister.options.Hyperlink && l.AbsPath != ""
+	if hyperlink {
+		output_buffer.WriteString(fmt.Sprintf(hyperlink_start,
+			file_url(lister.hostname, l.AbsPath)))
+	}
+
+	color := ""
+	if lister.options.Color {
+		color = lister.listing_color(l)
+	}
+
+	if color != "" {
+		output_buffer.WriteString(color)
+		output_buffer.WriteString(lister.quote(l.Name))
+		output_buffer.WriteString(lister.color_map["end"])
+	} else {
+		output_buffer.WriteString(lister.quote(l.Name))
+	}
+
+	if hyperlink {
+		output_buffer.WriteString(hyperlink_end)
+	}
+}
+
+// Write the given Listing's name to the output buffer, with the appropriate
+// formatting based on the Lister's options.
+func (lister *Lister) write_listing_name(output_buffer *bytes.Buffer,
+	l Listing) {
+
+	lister.write_colored_name(output_buffer, l)
+	output_buffer.WriteString(lister.indicator(l))
+
+	if l.Permissions[0] == 'l' && lister.options.Long {
+		if l.LinkOrphan && lister.color_map["link_orphan_target"] != "" {
+			output_buffer.WriteString(fmt.Sprintf(" -> %s%s%s",
+				lister.color_map["link_orphan_target"],
+				lister.quote(l.LinkName),
+				lister.color_map["end"]))
+		} else {
+			output_buffer.WriteString(fmt.Sprintf(" -> %s",
+				lister.quote(l.LinkName)))
+		}
+	}
+}
+
+// The fields of a Listing in the long format, formatted for printing.
+type long_listing struct {
+	listing        Listing
+	inode          string
+	blocks         string
+	permissions    string
+	num_hard_links string
+	owner          string
+	group          string
+	context        string
+	size           string
+	major          string // device numbers, for block and character devices
+	minor          string
+	timestamp      string
+}
+
+// Format the given size in bytes for printing, in the given units.  Sizes are
+// rounded up to a whole number of units, or for human-readable units as
+// format_human does, like GNU ls.
+func format_size(size_bytes uint64, units BlockSize) string {
+	if units.Human {
+		return format_human(size_bytes, units.SI)
+	}
+
+	unit := units.Bytes
+	if unit == 0 {
+		unit = 1
+	}
+
+	count := size_bytes / unit
+	if size_bytes%unit != 0 {
+		count++
+	}
+
+	size_str := fmt.Sprintf("%d", count)
+	if units.Group {
+		size_str = group_digits(size_str)
+	}
+
+	return size_str + units.Suffix
+}
+
+// Format the given number of 512-byte blocks for printing, in the given units.
+func format_blocks(blocks uint64, units BlockSize) string {
+	return format_size(blocks*512, units)
+}
+
+// Format the given timestamp (usually the modification time) for the long
+// format, returning the month, day, and either the hour:minute or, if older
+// than six months before now, the year.
+func format_time(mod_time time.Time, now time.Time) (string, string, string) {
+	month := mod_time.Month().String()[0:3]
+	day := fmt.Sprintf("%02d", mod_time.Day())
+
+	// if older than six months, print the year
+	// otherwise, print hour:minute
+	var time_str string
+	if !is_recent(mod_time, now) {
+		time_str = fmt.Sprintf("%d", mod_time.Year())
+	} else {
+		time_str = fmt.Sprintf("%02d:%02d",
+			mod_time.Hour(),
+			mod_time.Minute())
+	}
+
+	return month, day, time_str
+}
+
+// Format the fields of the given Listing for the long format, taking into
+// account the Lister's options.
+func (lister *Lister) create_long_listing(l Listing) long_listing {
+	ll := long_listing{
+		listing:        l,
+		inode:          fmt.Sprintf("%d", l.Inode),
+		blocks:         format_blocks(l.Blocks, lister.block_units()),
+		permissions:    l.Permissions,
+		num_hard_links: fmt.Sprintf("%d", l.NumHardLinks),
+		owner:          l.Owner,
+		group:          l.Group,
+		context:        lister.format_context(l.Context),
+		size:           format_size(l.Size, lister.size_units()),
+	}
+	if l.IsBlock || l.IsCharacter {
+		major, minor := device_numbers(l.Rdev)
+		ll.size = ""
+		ll.major = fmt.Sprintf("%d", major)
+		ll.minor = fmt.Sprintf("%d", minor)
+	}
+	if t := lister.listing_time(l); t.IsZero() {
+		// an unknown birth time is shown as a "?" at the end of the column
+		ll.timestamp = "?"
+	} else {
+		ll.timestamp = format_timestamp(t, lister.options.TimeStyle,
+			time.Now())
+	}
+
+	return ll
+}
+
+// Format the given security context for printing, using "?" for none like GNU
+// ls.  Contexts are quoted like names, since they come from the file system
+// too.
+func (lister *Lister) format_context(context string) string {
+	if context == "" {
+		return "?"
+	}
+
+	return lister.quote(context)
+}
+
+// Write the extended attributes of the given Listing to the output buffer, one
+// per line beneath its name.  Their names are quoted like file names.
+func (lister *Lister) write_xattrs_to_buffer(output_buffer *bytes.Buffer,
+	l Listing) {
+
+	for _, xattr := range l.Xattrs {
+		output_buffer.WriteString(
+			fmt.Sprintf("\n\t%s\t%d", lister.quote(xattr.Name), xattr.Size))
+	}
+}
+
+// Return the -i, -s and -Z columns to write before the name of each of the
+// given listings, right-justified to line up with each other.
+func (lister *Lister) name_prefixes(listings []Listing) []string {
+	inodes := make([]string, len(listings))
+	blocks := make([]string, len(listings))
+	contexts := make([]string, len(listings))
+	width_inode := 0
+	width_blocks := 0
+	width_context := 0
+
+	for i, l := range listings {
+		inodes[i] = fmt.Sprintf("%d", l.Inode)
+		blocks[i] = format_blocks(l.Blocks, lister.block_units())
+		contexts[i] = lister.format_context(l.Context)
+		if len(inodes[i]) > width_inode {
+			width_inode = len(inodes[i])
+		}
+		if len(blocks[i]) > width_blocks {
+			width_blocks = len(blocks[i])
+		}
+		if display_width(contexts[i]) > width_context {
+			width_context = display_width(contexts[i])
+		}
+	}
+
+	prefixes := make([]string, len(listings))
+	for i := range listings {
+		if lister.options.Inode {
+			prefixes[i] += fmt.Sprintf("%*s ", width_inode, inodes[i])
+		}
+		if lister.options.Blocks {
+			prefixes[i] += fmt.Sprintf("%*s ", width_blocks, blocks[i])
+		}
+		if lister.options.Context {
+			padding := width_context - display_width(contexts[i])
+			prefixes[i] += strings.Repeat(" ", padding) + contexts[i] + " "
+		}
+	}
+
+	return prefixes
+}
+
+// Write the "total" line that heads a directory's listings in the long format
+// or with -s, giving the number of blocks allocated to them.
+func (lister *Lister) write_total_to_buffer(output_buffer *bytes.Buffer,
+	listings []Listing) {
+
+	var total uint64
+	for _, l := range listings {
+		total += l.Blocks
+	}
+
+	output_buffer.WriteString("total ")
+	output_buffer.WriteString(format_blocks(total, lister.block_units()))
+}
+
+// Given a set of Listings, print them to the output buffer, taking into account
+// the Lister's options and terminal width as necessary.
+func (lister *Lister) write_listings_to_buffer(output_buffer *bytes.Buffer,
+	listings []Listing,
+	terminal_width int) {
+
+	if lister.options.JSON {
+		json_listings := make([]JSONListing, 0)
+		for _, l := range listings {
+			json_listings = append(json_listings, create_json_listing(l))
+		}
+
+		// a slice of plain structs always marshals successfully
+		json_bytes, _ := json.MarshalIndent(json_listings, "", "  ")
+		output_buffer.Write(json_bytes)
+		return
+	}
+
+	if len(listings) == 0 {
+		return
+	}
+
+	if lister.options.Long {
+		var (
+			width_inode          int = 0
+			width_blocks         int = 0
+			width_permissions    int = 0
+			width_num_hard_links int = 0
+			width_owner          int = 0
+			width_group          int = 0
+			width_context        int = 0
+			width_size           int = 0
+			width_major          int = 0
+			width_minor          int = 0
+			width_timestamp      int = 0
+		)
+		long_listings := make([]long_listing, 0)
+		for _, l := range listings {
+			long_listings = append(long_listings, lister.create_long_listing(l))
+		}
+
+		// check max widths for each field
+		for _, ll := range long_listings {
+			if len(ll.inode) > width_inode {
+				width_inode = len(ll.inode)
+			}
+			if len(ll.blocks) > width_blocks {
+				width_blocks = len(ll.blocks)
+			}
+			if len(ll.permissions) > width_permissions {
+				width_permissions = len(ll.permissions)
+			}
+			if len(ll.num_hard_links) > width_num_hard_links {
+				width_num_hard_links = len(ll.num_hard_links)
+			}
+			if display_width(ll.owner) > width_owner {
+				width_owner = display_width(ll.owner)
+			}
+			if display_width(ll.group) > width_group {
+				width_group = display_width(ll.group)
+			}
+			if display_width(ll.context) > width_context {
+				width_context = display_width(ll.context)
+			}
+			if len(ll.size) > width_size {
+				width_size = len(ll.size)
+			}
+			if len(ll.major) > width_major {
+				width_major = len(ll.major)
+			}
+			if len(ll.minor) > width_minor {
+				width_minor = len(ll.minor)
+			}
+			if display_width(ll.timestamp) > width_timestamp {
+				width_timestamp = display_width(ll.timestamp)
+			}
+		}
+
+		// devices show "major, minor" in place of their size, with each number
+		// aligned like coreutils
+		if width_major > 0 && width_major+2+width_minor > width_size {
+			width_size = width_major + 2 + width_minor
+		}
+
+		// now print the listings
+		for _, ll := range long_listings {
+			// inode number (right justified)
+			if lister.options.Inode {
+				for i := 0; i < width_inode-len(ll.inode); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(ll.inode)
+				output_buffer.WriteString(" ")
+			}
+
+			// allocated blocks (right justified)
+			if lister.options.Blocks {
+				for i := 0; i < width_blocks-len(ll.blocks); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(ll.blocks)
+				output_buffer.WriteString(" ")
+			}
+
+			// permissions
+			output_buffer.WriteString(ll.permissions)
+			for i := 0; i < width_permissions-len(ll.permissions); i++ {
+				output_buffer.WriteString(" ")
+			}
+			output_buffer.WriteString(" ")
+
+			// number of hard links (right justified)
+			for i := 0; i < width_num_hard_links-len(ll.num_hard_links); i++ {
+				output_buffer.WriteString(" ")
+			}
+			for i := 0; i < 2-width_num_hard_links; i++ {
+				output_buffer.WriteString(" ")
+			}
+			output_buffer.WriteString(ll.num_hard_links)
+			output_buffer.WriteString(" ")
+
+			// owner
+			if !lister.options.NoOwner {
+				output_buffer.WriteString(ll.owner)
+				for i := 0; i < width_owner-display_width(ll.owner); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(" ")
+			}
+
+			// group
+			if !lister.options.NoGroup {
+				output_buffer.WriteString(ll.group)
+				for i := 0; i < width_group-display_width(ll.group); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(" ")
+			}
+
+			// security context
+			if lister.options.Context {
+				output_buffer.WriteString(ll.context)
+				for i := 0; i < width_context-display_width(ll.context); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(" ")
+			}
+
+			// size, or device numbers (right justified)
+			if ll.major != "" {
+				width := width_size - 2 - width_minor
+				for i := 0; i < width-len(ll.major); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(ll.major)
+				output_buffer.WriteString(", ")
+				for i := 0; i < width_minor-len(ll.minor); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(ll.minor)
+			} else {
+				for i := 0; i < width_size-len(ll.size); i++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(ll.size)
+			}
+			output_buffer.WriteString(" ")
+
+			// timestamp (right justified)
+			for i := 0; i < width_timestamp-display_width(ll.timestamp); i++ {
+				output_buffer.WriteString(" ")
+			}
+			output_buffer.WriteString(ll.timestamp)
+			output_buffer.WriteString(" ")
+
+			// name, followed by any extended attributes
+			lister.write_listing_name(output_buffer, ll.listing)
+			lister.write_xattrs_to_buffer(output_buffer, ll.listing)
+			output_buffer.WriteString("\n")
+		}
+		if output_buffer.Len() > 0 {
+			output_buffer.Truncate(output_buffer.Len() - 1)
+		}
+	} else if lister.options.One || lister.options.Xattrs {
+		// extended attributes are listed beneath each entry, so there is only
+		// room for one per line
+		separator := "\n"
+		prefixes := lister.name_prefixes(listings)
+
+		for i, l := range listings {
+			output_buffer.WriteString(prefixes[i])
+			lister.write_listing_name(output_buffer, l)
+			lister.write_xattrs_to_buffer(output_buffer, l)
+			output_buffer.WriteString(separator)
+		}
+		if output_buffer.Len() > 0 {
+			output_buffer.Truncate(output_buffer.Len() - 1)
+		}
+	} else if lister.options.Commas {
+		prefixes := lister.name_prefixes(listings)
+
+		// like GNU ls, a line is broken where the next name and its separator
+		// wouldn't fit
+		position := 0
+		for i, l := range listings {
+			width := display_width(prefixes[i]) + lister.name_width(l)
+			if i > 0 {
+				if terminal_width <= 0 ||
+					position+width+2 < terminal_width {
+					output_buffer.WriteString(", ")
+					position += 2
+				} else {
+					output_buffer.WriteString(",\n")
+					position = 0
+				}
+			}
+			output_buffer.WriteString(prefixes[i])
+			lister.write_listing_name(output_buffer, l)
+			position += width
+		}
+	} else {
+		separator := "  "
+		prefixes := lister.name_prefixes(listings)
+
+		// the columns taken by each listing, which are the same for every
+		// number of rows tried
+		widths := make([]int, len(listings))
+		for i, l := range listings {
+			widths[i] = display_width(prefixes[i]) + lister.name_width(l)
+		}
+
+		// the column of the i'th listing, when listed down each column or
+		// across each row
+		column := func(i int, num_rows int, num_cols int) int {
+			if lister.options.Across {
+				return i % num_cols
+			}
+			return i / num_rows
+		}
+
+		// calculate the number of rows needed for column output
+		num_rows := 1
+		num_cols := 1
+		var col_widths []int
+		for {
+			num_cols_float := float64(len(listings)) / float64(num_rows)
+			num_cols_float = math.Ceil(num_cols_float)
+			num_cols = int(num_cols_float)
+
+			col_widths = make([]int, num_cols)
+			for i, _ := range col_widths {
+				col_widths[i] = 0
+			}
+
+			col_listings := make([]int, num_cols)
+			for i := 0; i < len(col_listings); i++ {
+				col_listings[i] = 0
+			}
+
+			// calculate necessary column widths
+			// also calculate the number of listings per column
+			for i := 0; i < len(listings); i++ {
+				col := column(i, num_rows, num_cols)
+				if col_widths[col] < widths[i] {
+					col_widths[col] = widths[i]
+				}
+				col_listings[col]++
+			}
+
+			// calculate the maximum width of each row
+			max_row_length := 0
+			for i := 0; i < num_cols; i++ {
+				max_row_length += col_widths[i]
+			}
+			max_row_length += len(separator) * (num_cols - 1)
+
+			// a terminal width of 0 means there is no limit
+			too_wide := terminal_width > 0 && max_row_length > terminal_width
+
+			if too_wide && num_rows >= len(listings) {
+				break
+			} else if too_wide {
+				num_rows++
+			} else if lister.options.Across {
+				// rows are filled in order, so only the last can be short
+				break
+			} else {
+				listings_in_first_col := col_listings[0]
+				listings_in_last_col := col_listings[len(col_listings)-1]
+
+				// prevent short last (right-hand) columns
+				if listings_in_last_col <= listings_in_first_col/2 &&
+					listings_in_first_col-listings_in_last_col >= 5 {
+					num_rows++
+				} else {
+					break
+				}
+			}
+		}
+
+		// filling rows across may leave fewer rows than were tried
+		if lister.options.Across {
+			num_rows = (len(listings) + num_cols - 1) / num_cols
+		}
+
+		for r := 0; r < num_rows; r++ {
+			// the listings in this row, from left to right
+			row := make([]int, 0)
+			for i := range listings {
+				if lister.options.Across && i/num_cols == r ||
+					!lister.options.Across && i%num_rows == r {
+					row = append(row, i)
+				}
+			}
+
+			for j, i := range row {
+				output_buffer.WriteString(prefixes[i])
+				lister.write_listing_name(output_buffer, listings[i])
+
+				// the last listing of a row isn't padded
+				if j == len(row)-1 {
+					break
+				}
+				col := column(i, num_rows, num_cols)
+				for s := 0; s < col_widths[col]-widths[i]; s++ {
+					output_buffer.WriteString(" ")
+				}
+				output_buffer.WriteString(separator)
+			}
+			output_buffer.WriteString("\n")
+		}
+		output_buffer.Truncate(output_buffer.Len() - 1)
+	}
+}
+
+// Return the path of the given entry inside the directory dirname, as used for
+// the headers of recursive listings (e.g. "." and "sub" -> "./sub").
+func join_path(dirname string, name string) string {
+	if strings.HasSuffix(dirname, "/") {
+		return dirname + name
+	}
+
+	return dirname + "/" + name
+}
+
+// Write the contents of the given directory to the output buffer.  If header is
+// set, the listings are preceded by a "dir:" line and followed by a blank line.
+func (lister *Lister) write_dir_to_buffer(output_buffer *bytes.Buffer,
+	dir Listing,
+	header bool,
+	terminal_width int) error {
+
+	return lister.walk_dir(dir, true,
+		func(d Listing, listings []Listing, readable bool) error {
+			if header {
+				lister.write_colored_name(output_buffer, d)
+				output_buffer.WriteString(":\n")
+			}
+
+			// as with GNU ls, there's no total for a directory that
+			// couldn't be read, only the error
+			if readable && (lister.options.Long || lister.options.Blocks) {
+				lister.write_total_to_buffer(output_buffer, listings)
+				if len(listings) > 0 || header {
+					output_buffer.WriteString("\n")
+				}
+			}
+
+			if len(listings) > 0 {
+				lister.write_listings_to_buffer(output_buffer,
+					listings,
+					terminal_width)
+				if header {
+					output_buffer.WriteString("\n\n")
+				}
+			} else if header {
+				output_buffer.WriteString("\n")
+			}
+
+			return nil
+		})
+}
+
+// Write the given Listing's name to the output buffer, with the appropriate
+// formatting based on the Lister's options.
+func (lister *Lister) WriteName(output_buffer *bytes.Buffer, l Listing) {
+	lister.write_listing_name(output_buffer, l)
+}
+
+// Write the given Listings to the output buffer, in the format selected by the
+// Lister's options, fitting columns to the given terminal width.
+func (lister *Lister) Write(output_buffer *bytes.Buffer,
+	listings []Listing,
+	terminal_width int) {
+
+	lister.write_listings_to_buffer(output_buffer, listings, terminal_width)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
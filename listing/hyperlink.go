@@ -0,0 +1,40 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The OSC 8 escape sequences that start a hyperlink to a URL, and end it.
+const (
+	hyperlink_start = "\x1b]8;;%s\x1b\\"
+	hyperlink_end   = "\x1b]8;;\x1b\\"
+)
+
+// Return the given string with every byte percent-encoded, except for the
+// unreserved characters of RFC 3986 and, if keep_slash is set, '/'.
+func percent_encode(s string, keep_slash bool) string {
+	var encoded bytes.Buffer
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			'0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' ||
+			c == '~' || c == '/' && keep_slash {
+			encoded.WriteByte(c)
+		} else {
+			encoded.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+
+	return encoded.String()
+}
+
+// Return the file:// URL of the given absolute path on the given host, e.g.
+// "file://host/a%20b" for "/a b".
+func file_url(hostname string, path string) string {
+	return "file://" + percent_encode(hostname, false) +
+		percent_encode(path, true)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
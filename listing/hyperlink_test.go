@@ -0,0 +1,17 @@
+package listing
+
+import (
+	"testing"
+)
+
+// Test the file:// URLs of hyperlinks, which percent-encode everything but the
+// unreserved characters, and the slashes of the path
+func Test_file_url(t *testing.T) {
+	check_output(t, file_url("host", "/a/b.txt"), "file://host/a/b.txt")
+	check_output(t, file_url("", "/a b"), "file:///a%20b")
+	check_output(t, file_url("my host", "/~a_b-c"), "file://my%20host/~a_b-c")
+	check_output(t, file_url("a/b", "/%#?\n"), "file://a%2Fb/%25%23%3F%0A")
+	check_output(t, file_url("h", "/café"), "file://h/caf%C3%A9")
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,173 @@
+package listing
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// The layout of the timestamps in --json output.  This is RFC 3339, but always
+// with a numeric offset from UTC, rather than "Z".
+const json_time_layout = "2006-01-02T15:04:05.999999999-07:00"
+
+// The JSON representation of a Listing, as written by --json.  Each timestamp
+// is given both as an RFC 3339 string in the Lister's time zone and in
+// nanoseconds since the epoch, and the birth time is left out unless it was
+// asked for and is known.
+type JSONListing struct {
+	Permissions  string  `json:"permissions"`
+	Mode         uint32  `json:"mode"`
+	NumHardLinks uint64  `json:"nlink"`
+	Owner        string  `json:"owner"`
+	Group        string  `json:"group"`
+	Uid          uint32  `json:"uid"`
+	Gid          uint32  `json:"gid"`
+	Size         uint64  `json:"size"`
+	Blocks       uint64  `json:"blocks"`
+	Rdev         uint64  `json:"rdev"`
+	Inode        uint64  `json:"inode"`
+	ModTime      string  `json:"mtime"`
+	EpochNano    int64   `json:"mtime_epoch_nano"`
+	AccessTime   string  `json:"atime"`
+	AccessNano   int64   `json:"atime_epoch_nano"`
+	ChangeTime   string  `json:"ctime"`
+	ChangeNano   int64   `json:"ctime_epoch_nano"`
+	BirthTime    string  `json:"btime,omitempty"`
+	BirthNano    int64   `json:"btime_epoch_nano,omitempty"`
+	Name         string  `json:"name"`
+	LinkName     string  `json:"link_target,omitempty"`
+	LinkOrphan   bool    `json:"link_orphan"`
+	Type         string  `json:"type"`
+	Context      string  `json:"context,omitempty"`
+	Xattrs       []Xattr `json:"xattrs,omitempty"`
+}
+
+// The listings of a single directory in a --json document.
+type JSONDirectory struct {
+	Path    string        `json:"path"`
+	Entries []JSONListing `json:"entries"`
+}
+
+// The --json document written when more than one block would be listed, such
+// as for multiple directory arguments or -R.
+type JSONDocument struct {
+	Files       []JSONListing   `json:"files"`
+	Directories []JSONDirectory `json:"directories"`
+}
+
+// Return the type of file the given Listing describes, as used by --json.
+func listing_type(l Listing) string {
+	if l.Permissions[0] == 'd' {
+		return "directory"
+	} else if l.Permissions[0] == 'l' {
+		return "symlink"
+	} else if l.IsSocket {
+		return "socket"
+	} else if l.IsPipe {
+		return "pipe"
+	} else if l.IsBlock {
+		return "block"
+	} else if l.IsCharacter {
+		return "character"
+	} else if l.IsDoor {
+		return "door"
+	}
+
+	return "file"
+}
+
+// Convert a Listing to its JSON representation.
+func create_json_listing(l Listing) JSONListing {
+	json_listing := JSONListing{
+		Permissions:  l.Permissions,
+		Mode:         l.Mode,
+		NumHardLinks: l.NumHardLinks,
+		Owner:        l.Owner,
+		Group:        l.Group,
+		Uid:          l.Uid,
+		Gid:          l.Gid,
+		Size:         l.Size,
+		Blocks:       l.Blocks,
+		Rdev:         l.Rdev,
+		Inode:        l.Inode,
+		ModTime:      l.ModTime.Format(json_time_layout),
+		EpochNano:    l.ModTime.UnixNano(),
+		AccessTime:   l.AccessTime.Format(json_time_layout),
+		AccessNano:   l.AccessTime.UnixNano(),
+		ChangeTime:   l.ChangeTime.Format(json_time_layout),
+		ChangeNano:   l.ChangeTime.UnixNano(),
+		Name:         l.Name,
+		LinkName:     l.LinkName,
+		LinkOrphan:   l.LinkOrphan,
+		Type:         listing_type(l),
+		Context:      l.Context,
+		Xattrs:       l.Xattrs,
+	}
+
+	if !l.BirthTime.IsZero() {
+		json_listing.BirthTime = l.BirthTime.Format(json_time_layout)
+		json_listing.BirthNano = l.BirthTime.UnixNano()
+	}
+
+	return json_listing
+}
+
+// Write the given files and directories to the output buffer as a single JSON
+// document.  Without headers, this is just the array of listings that
+// write_listings_to_buffer would produce.  Otherwise, the files and the
+// contents of each directory are grouped into a JSONDocument.
+func (lister *Lister) write_json_to_buffer(output_buffer *bytes.Buffer,
+	list_files []Listing,
+	list_dirs []Listing,
+	headers bool) error {
+
+	if !headers {
+		if len(list_dirs) == 0 {
+			lister.write_listings_to_buffer(output_buffer, list_files, 0)
+			return nil
+		}
+
+		return lister.walk_dir(list_dirs[0], true,
+			func(d Listing, listings []Listing, readable bool) error {
+				lister.write_listings_to_buffer(output_buffer, listings, 0)
+				return nil
+			})
+	}
+
+	document := JSONDocument{
+		Files:       make([]JSONListing, 0),
+		Directories: make([]JSONDirectory, 0),
+	}
+
+	for _, l := range list_files {
+		document.Files = append(document.Files, create_json_listing(l))
+	}
+
+	for _, d := range list_dirs {
+		err := lister.walk_dir(d, true,
+			func(d Listing, listings []Listing, readable bool) error {
+				dir := JSONDirectory{
+					Path:    d.Name,
+					Entries: make([]JSONListing, 0),
+				}
+				for _, l := range listings {
+					dir.Entries = append(dir.Entries, create_json_listing(l))
+				}
+				document.Directories = append(document.Directories, dir)
+
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	document_bytes, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	output_buffer.Write(document_bytes)
+
+	return nil
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,830 @@
+// Package listing is the engine behind the ls command.  A Lister, configured by
+// an Options struct, turns paths into Listings, sorts them, and writes them out
+// in any of the formats supported by ls.
+package listing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// This a FileInfo paired with the original path as passed in to the program.
+// Unfortunately, the Name() in FileInfo is only the basename, so the associated
+// path must be manually recorded as well.
+type FileInfoPath struct {
+	path string
+	info os.FileInfo
+}
+
+// The letters of the file types accepted by Options.Types: directories, regular
+// files, symlinks, named pipes, sockets, block and character devices, and
+// doors.
+const file_types = "dflpsbcD"
+
+// The file type bits of st_mode, and the type of Solaris doors, which
+// os.FileMode has no flag for.
+const (
+	mode_type_mask = 0170000
+	mode_type_door = 0150000
+)
+
+// This struct wraps all the settings of a Lister into a single object.
+type Options struct {
+	All         bool   // include entries starting with '.'
+	Long        bool   // long listing
+	Human       bool   // list sizes with human-readable units
+	One         bool   // one entry per line
+	Across      bool   // fill columns across each row, rather than down
+	Commas      bool   // separate entries by commas instead of columns
+	Dir         bool   // list directories like files
+	Color       bool   // colorize the names of the listings
+	SortReverse bool   // reverse any sorting
+	SortTime    bool   // sort entries by modify time
+	SortSize    bool   // sort entries by size
+	DirsFirst   bool   // list directories first
+	Recursive   bool   // list subdirectories recursively
+	JSON        bool   // list entries as JSON
+	Inode       bool   // print the inode number of each entry
+	Blocks      bool   // print the number of blocks allocated to each entry
+	NumericIDs  bool   // print uids and gids instead of user and group names
+	NoOwner     bool   // leave the owner out of the long listing
+	NoGroup     bool   // leave the group out of the long listing
+	Time        string // "atime", "ctime" or "birth" instead of mtime
+	TimeStyle   string // "full-iso", "long-iso", "iso", "relative" or "+FORMAT"
+	Xattrs      bool   // list the extended attributes under each entry
+	Context     bool   // print the SELinux security context of each entry
+	Indicator   string // "slash", "file-type" or "classify" to mark types
+	Quoting     string // style to quote names in, e.g. "shell", or "" for none
+	HideControl bool   // show unprintable characters in names as '?'
+	Hyperlink   bool   // link names to their files with OSC 8 escapes
+	Types       string // types to list, as letters like "dl", or "" for all
+	LSCOLORS    string // BSD color specification, checked first
+	LS_COLORS   string // GNU color specification
+
+	// time zone to show times in, or nil for local time
+	Location *time.Location
+
+	// the units of the size column, and of the -s column and total line,
+	// unless Human is set; the zero values are bytes and kibibytes
+	SizeUnits  BlockSize
+	BlockUnits BlockSize
+}
+
+// The name and size in bytes of one of a file's extended attributes.
+type Xattr struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// Listings contain all the information about a file or directory.  Numeric
+// fields are kept in their raw form, and are only formatted when the Listing is
+// written.
+type Listing struct {
+	Permissions  string    // e.g. "drwxr-xr-x", or "drwxr-xr-x+" with an ACL
+	NumHardLinks uint64    // number of hard links
+	Owner        string    // owner name, or the uid if it can't be found
+	Group        string    // group name, or the gid if it can't be found
+	Uid          uint32    // owner id
+	Gid          uint32    // group id
+	Size         uint64    // size in bytes
+	Blocks       uint64    // number of 512-byte blocks allocated
+	Rdev         uint64    // device number, for block and character devices
+	Inode        uint64    // inode number
+	Mode         uint32    // st_mode, including the file type bits
+	ModTime      time.Time // modification time
+	AccessTime   time.Time // access time
+	ChangeTime   time.Time // status change time
+	BirthTime    time.Time // birth time, only read with Options.Time "birth"
+	Name         string
+	LinkName     string
+	LinkOrphan   bool
+	IsSocket     bool
+	IsPipe       bool
+	IsBlock      bool
+	IsCharacter  bool
+	IsDoor       bool
+	Capability   bool    // whether the file has file capabilities set
+	Context      string  // SELinux context, only read for -l, -Z or JSON
+	Xattrs       []Xattr // extended attributes, only read with Options.Xattrs
+	AbsPath      string  // absolute path, only found with Options.Hyperlink
+
+	// the symlink's target, only found when symlinks are colored like their
+	// targets
+	link_target *Listing
+}
+
+// A Lister creates, sorts, and writes Listings according to its Options.  All
+// of the state that used to be global to the ls command lives here, so any
+// number of Listers can be used side by side, though a single Lister should
+// not be shared between goroutines.
+type Lister struct {
+	options      Options
+	user_map     map[int]string    // matches uid to username
+	group_map    map[int]string    // matches gid to groupname
+	color_map    map[string]string // matches file specification to output color
+	color_errors []error           // problems with the color options
+	errors       []error           // errors collected while listing
+	status       int               // exit status for the collected errors
+	hostname     string            // host name for the URLs of hyperlinks
+	color_target bool              // color symlinks like their targets
+}
+
+// The errors encountered while listing.  Listing carries on past problems with
+// individual paths, so a ListError may hold several of them.  As with GNU ls,
+// Status is 2 if a path given to the Lister could not be listed, or 1 if there
+// were only problems with the entries found beneath them.
+type ListError struct {
+	Errors []error
+	Status int
+}
+
+func (e ListError) Error() string {
+	messages := make([]string, 0)
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Read a file in the /etc/passwd or /etc/group format, and return a map of the
+// ids in the third field to the names in the first.
+func read_id_map(path string) (map[int]string, error) {
+	id_map := make(map[int]string)
+
+	id_file, err := os.Open(path)
+	if err != nil {
+		return id_map, fmt.Errorf("could not open %s for reading\n", path)
+	}
+	defer id_file.Close()
+
+	reader := bufio.NewReader(id_file)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		line = strings.Trim(line, " \t")
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		line_split := strings.Split(line, ":")
+		if len(line_split) < 3 {
+			continue
+		}
+
+		id, err := strconv.ParseInt(line_split[2], 10, 0)
+		if err != nil {
+			return id_map, err
+		}
+		id_map[int(id)] = line_split[0]
+	}
+
+	return id_map, nil
+}
+
+// Read in all the information from /etc/group, returning a map of gids to group
+// names.
+func ReadGroupMap() (map[int]string, error) {
+	return read_id_map("/etc/group")
+}
+
+// Read in all the information from /etc/passwd, returning a map of uids to
+// usernames.
+func ReadUserMap() (map[int]string, error) {
+	return read_id_map("/etc/passwd")
+}
+
+// Create a new Lister with the given options.  The user and group tables are
+// read up front, unless only numeric ids are wanted, as are the color settings
+// if colors are enabled.
+func NewLister(options Options) (*Lister, error) {
+	var err error
+
+	if options.Time != "" && options.Time != "atime" &&
+		options.Time != "ctime" && options.Time != "birth" {
+		return nil, fmt.Errorf("invalid time '%s'", options.Time)
+	}
+	if options.Indicator != "" && options.Indicator != "slash" &&
+		options.Indicator != "file-type" && options.Indicator != "classify" {
+		return nil, fmt.Errorf("invalid indicator style '%s'",
+			options.Indicator)
+	}
+	if !valid_time_style(options.TimeStyle) {
+		return nil, fmt.Errorf("invalid time style '%s'", options.TimeStyle)
+	}
+	if !valid_quoting_style(options.Quoting) {
+		return nil, fmt.Errorf("invalid quoting style '%s'", options.Quoting)
+	}
+	for _, t := range options.Types {
+		if !strings.ContainsRune(file_types, t) {
+			return nil, fmt.Errorf("invalid file type '%c'", t)
+		}
+	}
+
+	lister := &Lister{
+		options:   options,
+		user_map:  make(map[int]string),
+		group_map: make(map[int]string),
+	}
+
+	if !options.NumericIDs {
+		lister.group_map, err = ReadGroupMap()
+		if err != nil {
+			return nil, err
+		}
+
+		lister.user_map, err = ReadUserMap()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Color {
+		lister.setup_colors()
+	}
+
+	// as with GNU ls, the URLs are left without a host if its name can't be
+	// found
+	if options.Hyperlink {
+		lister.hostname, _ = os.Hostname()
+	}
+
+	return lister, nil
+}
+
+// Record an error and carry on listing.  Serious errors are those with the
+// paths passed in to the Lister, rather than the entries found beneath them.
+// The paths in errors from the os package are quoted like names, since they
+// are written to the terminal too.
+func (lister *Lister) add_error(err error, serious bool) {
+	if path_err, ok := err.(*os.PathError); ok {
+		err = &os.PathError{Op: path_err.Op, Path: lister.quote(path_err.Path),
+			Err: path_err.Err}
+	}
+	lister.errors = append(lister.errors, err)
+
+	if serious {
+		lister.status = 2
+	} else if lister.status == 0 {
+		lister.status = 1
+	}
+}
+
+// Forget any errors recorded by a previous listing.
+func (lister *Lister) reset_errors() {
+	lister.errors = make([]error, 0)
+	lister.status = 0
+}
+
+// Return the recorded errors as a ListError, or nil if there were none.
+func (lister *Lister) collected_errors() error {
+	if len(lister.errors) == 0 {
+		return nil
+	}
+
+	return ListError{lister.errors, lister.status}
+}
+
+// Convert a FileInfoPath object to a Listing.  The dirname is passed for
+// following symlinks.
+func (lister *Lister) create_listing(dirname string,
+	fip FileInfoPath) (Listing, error) {
+
+	var current_listing Listing
+
+	// permissions string
+	current_listing.Permissions = fip.info.Mode().String()
+	if fip.info.Mode()&os.ModeSymlink == os.ModeSymlink {
+		current_listing.Permissions = strings.Replace(
+			current_listing.Permissions, "L", "l", 1)
+
+		var _pathstr string
+		if dirname == "" {
+			_pathstr = fmt.Sprintf("%s", fip.path)
+		} else {
+			_pathstr = fmt.Sprintf("%s/%s", dirname, fip.path)
+		}
+		link, err := os.Readlink(_pathstr)
+		if err != nil {
+			return current_listing, err
+		}
+		current_listing.LinkName = link
+
+		// check to see if the symlink target exists
+		var _link_pathstr string
+		if dirname == "" {
+			_link_pathstr = fmt.Sprintf("%s", link)
+		} else {
+			_link_pathstr = fmt.Sprintf("%s/%s", dirname, link)
+		}
+		target_info, err := os.Stat(_link_pathstr)
+		if err != nil && os.IsNotExist(err) {
+			current_listing.LinkOrphan = true
+		} else if err == nil && lister.color_target {
+			target, err := lister.create_listing(dirname,
+				FileInfoPath{link, target_info})
+			if err == nil {
+				current_listing.link_target = &target
+			}
+		}
+	} else if current_listing.Permissions[0] == 'D' {
+		// Go marks every device with a "D", and character devices with a "c"
+		// as well, so block devices are given their "b" here
+		current_listing.Permissions = current_listing.Permissions[1:]
+		if fip.info.Mode()&os.ModeCharDevice == 0 {
+			current_listing.Permissions = "b" + current_listing.Permissions
+		}
+	} else if current_listing.Permissions[0:2] == "ug" {
+		current_listing.Permissions =
+			strings.Replace(current_listing.Permissions, "ug", "-", 1)
+		current_listing.Permissions = fmt.Sprintf("%ss%ss%s",
+			current_listing.Permissions[0:3],
+			current_listing.Permissions[4:6],
+			current_listing.Permissions[7:])
+	} else if current_listing.Permissions[0] == 'u' {
+		current_listing.Permissions =
+			strings.Replace(current_listing.Permissions, "u", "-", 1)
+		current_listing.Permissions = fmt.Sprintf("%ss%s",
+			current_listing.Permissions[0:3],
+			current_listing.Permissions[4:])
+	} else if current_listing.Permissions[0] == 'g' {
+		current_listing.Permissions =
+			strings.Replace(current_listing.Permissions, "g", "-", 1)
+		current_listing.Permissions = fmt.Sprintf("%ss%s",
+			current_listing.Permissions[0:6],
+			current_listing.Permissions[7:])
+	} else if current_listing.Permissions[0:2] == "dt" {
+		current_listing.Permissions =
+			strings.Replace(current_listing.Permissions, "dt", "d", 1)
+		current_listing.Permissions = fmt.Sprintf("%st",
+			current_listing.Permissions[0:len(current_listing.Permissions)-1])
+	}
+
+	sys := fip.info.Sys()
+
+	stat, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return current_listing, fmt.Errorf("syscall failed\n")
+	}
+
+	// number of hard links
+	current_listing.NumHardLinks = uint64(stat.Nlink)
+
+	// owner
+	current_listing.Uid = stat.Uid
+	uid_str := fmt.Sprintf("%d", stat.Uid)
+	if lister.options.NumericIDs {
+		// -n skips the lookups altogether
+		current_listing.Owner = uid_str
+	} else if owner, err := user.LookupId(uid_str); err != nil {
+		// if this causes an error, use the manual user_map
+		//
+		// this can happen if go is built using cross-compilation for multiple
+		// architectures (such as with Fedora Linux), in which case these
+		// OS-specific features aren't implemented
+		_owner := lister.user_map[int(stat.Uid)]
+		if _owner == "" {
+			// if the user isn't in the map, just use the uid number
+			current_listing.Owner = uid_str
+		} else {
+			current_listing.Owner = _owner
+		}
+	} else {
+		current_listing.Owner = owner.Username
+	}
+
+	// group
+	current_listing.Gid = stat.Gid
+	_group := lister.group_map[int(stat.Gid)]
+	if _group == "" {
+		// if the group isn't in the map, just use the gid number
+		current_listing.Group = fmt.Sprintf("%d", stat.Gid)
+	} else {
+		current_listing.Group = _group
+	}
+
+	// raw mode bits, size, inode number, and modification time, which are
+	// formatted when the listing is written
+	current_listing.Mode = uint32(stat.Mode)
+	current_listing.Size = uint64(fip.info.Size())
+	current_listing.Blocks = uint64(stat.Blocks)
+	current_listing.Rdev = uint64(stat.Rdev)
+	current_listing.Inode = stat.Ino
+	current_listing.ModTime = fip.info.ModTime()
+
+	current_listing.Name = fip.path
+
+	// character?
+	if fip.info.Mode()&os.ModeCharDevice == os.ModeCharDevice {
+		current_listing.IsCharacter = true
+	} else if fip.info.Mode()&os.ModeDevice == os.ModeDevice { // block?
+		current_listing.IsBlock = true
+	} else if fip.info.Mode()&os.ModeNamedPipe == os.ModeNamedPipe { // pipe?
+		current_listing.IsPipe = true
+	} else if fip.info.Mode()&os.ModeSocket == os.ModeSocket { // socket?
+		current_listing.IsSocket = true
+	} else if current_listing.Mode&mode_type_mask == mode_type_door { // door?
+		current_listing.IsDoor = true
+	}
+
+	path := fip.path
+	if dirname != "" {
+		path = join_path(dirname, fip.path)
+	}
+
+	// file capabilities are only looked up if they would be colored, since
+	// it takes an extra system call for every file
+	if fip.info.Mode().IsRegular() && lister.color_map["capability"] != "" {
+		current_listing.Capability = has_xattr(path, "security.capability")
+	}
+
+	// as with GNU ls, a "+" after the permissions marks a file with an ACL,
+	// and otherwise a "." marks one with a security context.  These take up
+	// to three extra system calls for every file, so they're only looked up
+	// if they would be shown
+	if lister.options.Long || lister.options.Context || lister.options.JSON {
+		acl := has_xattr(path, "system.posix_acl_access") ||
+			(fip.info.IsDir() &&
+				has_xattr(path, "system.posix_acl_default"))
+		current_listing.Context = get_xattr(path, "security.selinux")
+		if acl {
+			current_listing.Permissions += "+"
+		} else if current_listing.Context != "" {
+			current_listing.Permissions += "."
+		}
+	}
+
+	if lister.options.Xattrs {
+		current_listing.Xattrs = list_xattrs(path)
+	}
+
+	// hyperlinks are left out if the working directory can't be found
+	if lister.options.Hyperlink {
+		current_listing.AbsPath, _ = filepath.Abs(path)
+	}
+
+	// the birth time takes an extra system call on Linux, so it's only looked
+	// up when it would be used
+	current_listing.AccessTime, current_listing.ChangeTime =
+		access_change_times(stat)
+	if lister.options.Time == "birth" {
+		current_listing.BirthTime = birth_time(path, stat)
+	}
+
+	// every timestamp is kept in the chosen time zone, so that they're all
+	// written in it
+	if location := lister.options.Location; location != nil {
+		current_listing.ModTime = current_listing.ModTime.In(location)
+		current_listing.AccessTime = current_listing.AccessTime.In(location)
+		current_listing.ChangeTime = current_listing.ChangeTime.In(location)
+		current_listing.BirthTime = current_listing.BirthTime.In(location)
+	}
+
+	return current_listing, nil
+}
+
+// Return the timestamp of the given Listing that the Lister shows and sorts by,
+// as selected by Options.Time.  This is the zero time if it isn't known.
+func (lister *Lister) listing_time(l Listing) time.Time {
+	switch lister.options.Time {
+	case "atime":
+		return l.AccessTime
+	case "ctime":
+		return l.ChangeTime
+	case "birth":
+		return l.BirthTime
+	}
+
+	return l.ModTime
+}
+
+// Return the letter of the type of the given Listing, as used by
+// Options.Types: the same as those of 'find -type'.
+func type_letter(l Listing) byte {
+	if l.Permissions[0] == 'd' {
+		return 'd'
+	} else if l.Permissions[0] == 'l' {
+		return 'l'
+	} else if l.IsSocket {
+		return 's'
+	} else if l.IsPipe {
+		return 'p'
+	} else if l.IsBlock {
+		return 'b'
+	} else if l.IsCharacter {
+		return 'c'
+	} else if l.IsDoor {
+		return 'D'
+	}
+
+	return 'f'
+}
+
+// Return whether the given Listing is of one of the types in Options.Types,
+// which are all listed if none are given.
+func (lister *Lister) matches_type(l Listing) bool {
+	types := lister.options.Types
+
+	return types == "" || strings.IndexByte(types, type_letter(l)) != -1
+}
+
+// Create a set of Listings, comprised of the files and directories currently in
+// the given directory, leaving out those that aren't of the types in
+// Options.Types.  With -R, the subdirectories to descend into are also
+// returned, whether or not they are listed.  An error is returned if the
+// directory can't be read, while problems with individual entries are recorded
+// and those entries are left out.
+func (lister *Lister) list_files_in_dir(dir Listing) ([]Listing, []Listing,
+	error) {
+
+	l := make([]Listing, 0)
+	subdirs := make([]Listing, 0)
+
+	if lister.options.All {
+		//info_dot, err := os.Stat(dir.path)
+		info_dot, err := os.Stat(dir.Name)
+		if err != nil {
+			return l, subdirs, err
+		}
+
+		listing_dot, err := lister.create_listing(dir.Name,
+			FileInfoPath{".", info_dot})
+		if err != nil {
+			return l, subdirs, err
+		}
+
+		info_dotdot, err := os.Stat(dir.Name + "/..")
+		if err != nil {
+			return l, subdirs, err
+		}
+
+		listing_dotdot, err := lister.create_listing(dir.Name,
+			FileInfoPath{"..", info_dotdot})
+		if err != nil {
+			return l, subdirs, err
+		}
+
+		if lister.matches_type(listing_dot) {
+			l = append(l, listing_dot)
+			l = append(l, listing_dotdot)
+		}
+	}
+
+	files_in_dir, err := ioutil.ReadDir(dir.Name)
+	if err != nil {
+		return l, subdirs, err
+	}
+
+	for _, f := range files_in_dir {
+		// if this is a .dotfile and '-a' is not specified, skip it
+		if []rune(f.Name())[0] == rune('.') && !lister.options.All {
+			continue
+		}
+
+		_l, err := lister.create_listing(dir.Name,
+			FileInfoPath{f.Name(), f})
+		if err != nil {
+			lister.add_error(err, false)
+			continue
+		}
+
+		// -R only descends into real directories, not symlinks to them
+		if lister.options.Recursive && _l.Permissions[0] == 'd' {
+			subdirs = append(subdirs, _l)
+		}
+		if lister.matches_type(_l) {
+			l = append(l, _l)
+		}
+	}
+
+	lister.sort_listings(l)
+	lister.sort_listings(subdirs)
+
+	return l, subdirs, nil
+}
+
+// Call visit with the given directory, its sorted listings, and whether it
+// could be read.  With -R, every subdirectory is then visited the same way,
+// depth-first.  A directory that can't be read is recorded as an error and
+// visited with no listings; this is serious for the top_level directory passed
+// in to the Lister.  Only errors returned by visit stop the walk.
+func (lister *Lister) walk_dir(dir Listing,
+	top_level bool,
+	visit func(Listing, []Listing, bool) error) error {
+
+	listings, subdirs, err := lister.list_files_in_dir(dir)
+	readable := err == nil
+	if !readable {
+		lister.add_error(err, top_level)
+		listings = make([]Listing, 0)
+	}
+
+	if lister.options.DirsFirst {
+		listings = sort_listings_dirs_first(listings)
+	}
+
+	err = visit(dir, listings, readable)
+	if err != nil {
+		return err
+	}
+
+	if !lister.options.Recursive {
+		return nil
+	}
+
+	for _, l := range subdirs {
+		subdir := l
+		subdir.Name = join_path(dir.Name, l.Name)
+
+		err := lister.walk_dir(subdir, false, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create a Listing for the file or directory at the given path, as passed in to
+// the program.  Symlinks are not followed.  The path is quoted in the errors
+// made here, like the names in listings.
+func (lister *Lister) Stat(path string) (Listing, error) {
+	info, err := os.Lstat(path)
+
+	if err != nil && os.IsNotExist(err) {
+		return Listing{},
+			fmt.Errorf("cannot access %s: no such file or directory",
+				lister.quote(path))
+	} else if err != nil && os.IsPermission(err) {
+		return Listing{}, fmt.Errorf("open %s: permission denied",
+			lister.quote(path))
+	} else if err != nil {
+		return Listing{}, err
+	}
+
+	return lister.create_listing("", FileInfoPath{path, info})
+}
+
+// Return the sorted Listings of the files and directories in the given
+// directory.  Entries that can't be listed are left out, and reported in a
+// ListError along with the ones that could.
+func (lister *Lister) ListDir(dir Listing) ([]Listing, error) {
+	lister.reset_errors()
+
+	listings, _, err := lister.list_files_in_dir(dir)
+	if err != nil {
+		lister.add_error(err, true)
+	}
+
+	return listings, lister.collected_errors()
+}
+
+// Call visit with the given directory and its sorted listings.  If the Lister
+// is recursive, every subdirectory is then visited the same way, depth-first.
+// Directories that can't be read are visited with no listings, and reported in
+// a ListError once the walk is done.  An error returned by visit stops the
+// walk, and is returned as is.
+func (lister *Lister) Walk(dir Listing,
+	visit func(Listing, []Listing) error) error {
+
+	lister.reset_errors()
+
+	err := lister.walk_dir(dir, true,
+		func(d Listing, listings []Listing, readable bool) error {
+			return visit(d, listings)
+		})
+	if err != nil {
+		return err
+	}
+
+	return lister.collected_errors()
+}
+
+// Write the listings of the files and directories at the given paths to the
+// output buffer, just as the ls command would.  With no paths, the current
+// directory is listed.  Paths that can't be listed are skipped, and reported in
+// a ListError once everything else has been written.  A terminal width of 0
+// places no limit on the width of column output.
+func (lister *Lister) List(output_buffer *bytes.Buffer,
+	paths []string,
+	terminal_width int) error {
+
+	lister.reset_errors()
+
+	list_dirs := make([]Listing, 0)
+	list_files := make([]Listing, 0)
+
+	// if no files are specified, list the current directory
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	//
+	// separate the files from the directories
+	//
+	for _, f := range paths {
+		f_listing, err := lister.Stat(f)
+		if err != nil {
+			lister.add_error(err, true)
+			continue
+		}
+
+		// for option_dir (-d), treat directories like regular files, and
+		// filter the files by type like the contents of directories
+		if lister.options.Dir || f_listing.Permissions[0] != 'd' {
+			if lister.matches_type(f_listing) {
+				list_files = append(list_files, f_listing)
+			}
+		} else {
+			list_dirs = append(list_dirs, f_listing)
+		}
+	}
+
+	num_files := len(list_files)
+	num_dirs := len(list_dirs)
+
+	// sort the lists if necessary
+	lister.sort_listings(list_files)
+	lister.sort_listings(list_dirs)
+
+	// print "dir:" headers whenever more than one path was given, even if
+	// some of them couldn't be listed
+	headers := num_dirs > 0 && (len(paths) > 1 || lister.options.Recursive)
+
+	if lister.options.JSON {
+		err := lister.write_json_to_buffer(output_buffer,
+			list_files,
+			list_dirs,
+			headers)
+		if err != nil {
+			return err
+		}
+
+		return lister.collected_errors()
+	}
+
+	//
+	// list the files first (unless --dirs-first)
+	//
+	if num_files > 0 && !lister.options.DirsFirst {
+		lister.write_listings_to_buffer(output_buffer,
+			list_files,
+			terminal_width)
+	}
+
+	//
+	// then list the directories
+	//
+	if headers {
+		if num_files > 0 && !lister.options.DirsFirst {
+			output_buffer.WriteString("\n\n")
+		}
+
+		for _, d := range list_dirs {
+			err := lister.write_dir_to_buffer(output_buffer,
+				d,
+				true,
+				terminal_width)
+			if err != nil {
+				return err
+			}
+		}
+
+		output_buffer.Truncate(output_buffer.Len() - 2)
+	} else if num_dirs == 1 {
+		err := lister.write_dir_to_buffer(output_buffer,
+			list_dirs[0],
+			false,
+			terminal_width)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// list the files now if --dirs-first
+	//
+	if num_files > 0 && lister.options.DirsFirst {
+		if num_dirs > 0 {
+			output_buffer.WriteString("\n\n")
+		}
+		lister.write_listings_to_buffer(output_buffer,
+			list_files,
+			terminal_width)
+	}
+
+	return lister.collected_errors()
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,214 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// create an empty file at the given path, failing the test on error
+func _mkfile(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("os.Create(%s): %v", path, err)
+	}
+	f.Close()
+}
+
+// fail the given test if the output and expected strings do not match
+func check_output(t *testing.T, output, expected string) {
+	if output != expected {
+		t.Logf("\nexpected:\n\"%s\"\n\nbut got:\n\"%s\"\n", expected, output)
+		t.Fail()
+	}
+}
+
+// Test using a Lister directly, without going through the ls command
+func Test_Lister_ListDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listing_")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_mkfile(t, dir+"/b")
+	_mkfile(t, dir+"/a")
+	err = os.Mkdir(dir+"/c", 0755)
+	if err != nil {
+		t.Fatalf("os.Mkdir(%s/c): %v", dir, err)
+	}
+
+	lister, err := NewLister(Options{DirsFirst: true})
+	if err != nil {
+		t.Fatalf("NewLister: %v", err)
+	}
+
+	dir_listing, err := lister.Stat(dir)
+	if err != nil {
+		t.Fatalf("Stat(%s): %v", dir, err)
+	}
+	check_output(t, dir_listing.Permissions[0:1], "d")
+
+	listings, err := lister.ListDir(dir_listing)
+	if err != nil {
+		t.Fatalf("ListDir(%s): %v", dir, err)
+	}
+
+	output := ""
+	for _, l := range listings {
+		output += l.Name + " "
+	}
+	check_output(t, output, "a b c ")
+
+	var output_buffer bytes.Buffer
+	err = lister.List(&output_buffer, []string{dir}, 80)
+	if err != nil {
+		t.Fatalf("List(%s): %v", dir, err)
+	}
+	check_output(t, output_buffer.String(), "c  a  b")
+}
+
+// Test that Options.Types leaves out the entries of other types, and that
+// unknown types are rejected
+func Test_Lister_Types(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listing_")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	_mkfile(t, dir+"/a")
+	err = os.Mkdir(dir+"/b", 0755)
+	if err != nil {
+		t.Fatalf("os.Mkdir(%s/b): %v", dir, err)
+	}
+	err = os.Symlink("a", dir+"/c")
+	if err != nil {
+		t.Fatalf("os.Symlink(a, %s/c): %v", dir, err)
+	}
+
+	types := map[string]string{
+		"":    "a b c ",
+		"d":   "b ",
+		"f":   "a ",
+		"fl":  "a c ",
+		"psb": "",
+	}
+
+	for t_types, expected := range types {
+		lister, err := NewLister(Options{Types: t_types})
+		if err != nil {
+			t.Fatalf("NewLister: %v", err)
+		}
+
+		dir_listing, err := lister.Stat(dir)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", dir, err)
+		}
+
+		listings, err := lister.ListDir(dir_listing)
+		if err != nil {
+			t.Fatalf("ListDir(%s): %v", dir, err)
+		}
+
+		output := ""
+		for _, l := range listings {
+			output += l.Name + " "
+		}
+		check_output(t, output, expected)
+	}
+
+	_, err = NewLister(Options{Types: "dx"})
+	if err == nil || err.Error() != "invalid file type 'x'" {
+		t.Logf("NewLister should reject type 'x', but got %v", err)
+		t.Fail()
+	}
+}
+
+// Test that the device numbers of character and block devices are shown in
+// place of their sizes, aligned with the sizes of regular files
+func Test_Lister_Device(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listing_")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(dir+"/a", make([]byte, 1234567), 0644)
+	if err != nil {
+		t.Fatalf("ioutil.WriteFile(%s/a): %v", dir, err)
+	}
+
+	lister, err := NewLister(Options{Long: true, NumericIDs: true})
+	if err != nil {
+		t.Fatalf("NewLister: %v", err)
+	}
+
+	var output_buffer bytes.Buffer
+	err = lister.List(&output_buffer, []string{"/dev/null", dir + "/a"}, 80)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	lines := strings.Split(output_buffer.String(), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", output_buffer.String())
+	}
+
+	null, err := lister.Stat("/dev/null")
+	if err != nil {
+		t.Fatalf("Stat(/dev/null): %v", err)
+	}
+	major, minor := device_numbers(null.Rdev)
+	device := fmt.Sprintf(" %d, %d ", major, minor)
+	if !strings.Contains(lines[0], device) {
+		t.Logf("expected %q in %q", device, lines[0])
+		t.Fail()
+	}
+
+	// the names line up
+	check_output(t, fmt.Sprint(strings.Index(lines[0], "/dev/null")),
+		fmt.Sprint(strings.Index(lines[1], dir)))
+
+	// block devices are marked with a "b", and line up too
+	devices, err := ioutil.ReadDir("/dev")
+	if err != nil {
+		t.Skipf("/dev can't be read: %v", err)
+	}
+	block := ""
+	for _, info := range devices {
+		if info.Mode()&os.ModeDevice != 0 &&
+			info.Mode()&os.ModeCharDevice == 0 {
+			block = "/dev/" + info.Name()
+			break
+		}
+	}
+	if block == "" {
+		t.Skip("there are no block devices in /dev")
+	}
+
+	output_buffer.Reset()
+	err = lister.List(&output_buffer, []string{block, "/dev/null"}, 80)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	lines = strings.Split(output_buffer.String(), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", output_buffer.String())
+	}
+	if !strings.Contains(lines[0], block) {
+		lines[0], lines[1] = lines[1], lines[0]
+	}
+	if !strings.HasPrefix(lines[0], "b") {
+		t.Logf("expected the permissions of a block device in %q", lines[0])
+		t.Fail()
+	}
+	check_output(t, fmt.Sprint(strings.Index(lines[0], block)),
+		fmt.Sprint(strings.Index(lines[1], "/dev/null")))
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,202 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The quoting styles accepted by Options.Quoting, besides "" for literal names.
+var quoting_styles = []string{"literal", "shell", "shell-always",
+	"shell-escape", "shell-escape-always", "c", "escape", "locale"}
+
+// The characters that the shell treats specially, which make a name need
+// quoting in the shell styles.
+const shell_special = " \t!\"$&'()*;<=>?[\\^`|"
+
+// Return whether the given quoting style is one of the styles above.
+func valid_quoting_style(style string) bool {
+	if style == "" {
+		return true
+	}
+
+	for _, s := range quoting_styles {
+		if style == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether the given character can be written to a terminal as it is.
+// Invalid UTF-8 is decoded as utf8.RuneError, and so isn't printable, while
+// format characters such as the joiners of emoji sequences are.
+func is_printable(r rune) bool {
+	return r != utf8.RuneError &&
+		(unicode.IsGraphic(r) || unicode.Is(unicode.Cf, r))
+}
+
+// The opposite of is_printable, for strings.IndexFunc.
+func not_printable(r rune) bool {
+	return !is_printable(r)
+}
+
+// Return the given name with each character that isn't printable replaced by
+// '?', as with -q.
+func hide_control_chars(name string) string {
+	var hidden bytes.Buffer
+
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if is_printable(r) {
+			hidden.WriteString(name[i : i+size])
+		} else {
+			hidden.WriteByte('?')
+		}
+		i += size
+	}
+
+	return hidden.String()
+}
+
+// The C escapes of the control characters that have them.
+var c_escapes = map[rune]string{
+	'\a': "\\a",
+	'\b': "\\b",
+	'\f': "\\f",
+	'\n': "\\n",
+	'\r': "\\r",
+	'\t': "\\t",
+	'\v': "\\v",
+}
+
+// Return the given name with backslash escapes in the style of C strings for
+// backslashes, the characters in special, and the characters that aren't
+// printable.  Those without an escape of their own, and invalid UTF-8, are
+// written as the octal value of each byte, e.g. "\033" for ESC.
+func escape_c(name string, special string) string {
+	var escaped bytes.Buffer
+
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+
+		if is_printable(r) {
+			if r == '\\' || strings.ContainsRune(special, r) {
+				escaped.WriteByte('\\')
+			}
+			escaped.WriteString(name[i : i+size])
+		} else if c_escape, ok := c_escapes[r]; ok {
+			escaped.WriteString(c_escape)
+		} else {
+			for _, b := range []byte(name[i : i+size]) {
+				escaped.WriteString(fmt.Sprintf("\\%03o", b))
+			}
+		}
+		i += size
+	}
+
+	return escaped.String()
+}
+
+// Return whether the given name would have to be quoted to be used as a single
+// word in the shell.  As with GNU ls, '#' and '~' only matter at the start of
+// a name, and braces only on their own.
+func needs_shell_quotes(name string) bool {
+	if name == "" || name == "{" || name == "}" ||
+		strings.HasPrefix(name, "#") || strings.HasPrefix(name, "~") {
+		return true
+	}
+
+	for _, r := range name {
+		if strings.ContainsRune(shell_special, r) || !is_printable(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the given text in single quotes.  Each single quote inside it ends
+// the quotes, is escaped with a backslash, and starts them again.
+func single_quote(text string) string {
+	return "'" + strings.Replace(text, "'", "'\\''", -1) + "'"
+}
+
+// Quote the given name for the shell, in one of the "shell" styles.  Names are
+// only quoted if they need to be, except with the "-always" styles, and those
+// with single quotes, but nothing else that is special inside double quotes,
+// are put in double quotes instead.  With the "shell-escape" styles, the
+// characters that aren't printable are written as $'...' strings between the
+// quoted runs of the rest, e.g. $'\n' for a newline.
+func quote_shell(name string, style string) string {
+	if !strings.HasSuffix(style, "-always") && !needs_shell_quotes(name) {
+		return name
+	}
+
+	has_control := strings.IndexFunc(name, not_printable) != -1
+	if !strings.HasPrefix(style, "shell-escape") || !has_control {
+		if strings.Contains(name, "'") && !has_control &&
+			!strings.ContainsAny(name, "\"$`\\!") {
+			return "\"" + name + "\""
+		}
+		return single_quote(name)
+	}
+
+	// alternate between the runs of printable characters and the rest
+	var quoted bytes.Buffer
+	for len(name) > 0 {
+		end := strings.IndexFunc(name, not_printable)
+		if end == 0 {
+			end = strings.IndexFunc(name, is_printable)
+			if end == -1 {
+				end = len(name)
+			}
+			quoted.WriteString("$'" + escape_c(name[:end], "") + "'")
+		} else {
+			if end == -1 {
+				end = len(name)
+			}
+			quoted.WriteString(single_quote(name[:end]))
+		}
+		name = name[end:]
+	}
+
+	return quoted.String()
+}
+
+// Return the given name as it is written in the given quoting style.  With
+// hide_control set, the characters that aren't printable are shown as '?' in
+// the styles that would otherwise write them as they are.
+func quote_name(name string, style string, hide_control bool) string {
+	switch style {
+	case "shell-escape", "shell-escape-always":
+		return quote_shell(name, style)
+	case "shell", "shell-always":
+		if hide_control {
+			name = hide_control_chars(name)
+		}
+		return quote_shell(name, style)
+	case "c":
+		return "\"" + escape_c(name, "\"") + "\""
+	case "escape":
+		return escape_c(name, " ")
+	case "locale":
+		return "‘" + escape_c(name, "’") + "’"
+	}
+
+	if hide_control {
+		return hide_control_chars(name)
+	}
+
+	return name
+}
+
+// Return the given name as it is written by the Lister.
+func (lister *Lister) quote(name string) string {
+	return quote_name(name, lister.options.Quoting, lister.options.HideControl)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
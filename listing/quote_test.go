@@ -0,0 +1,56 @@
+package listing
+
+import (
+	"testing"
+)
+
+// Test quoting names in each quoting style
+func Test_quote_name(t *testing.T) {
+	tests := []struct {
+		name     string
+		style    string
+		expected string
+	}{
+		{"a", "", "a"},
+		{"a\nb", "", "a\nb"},
+		{"a", "shell", "a"},
+		{"", "shell", "''"},
+		{"a b", "shell", "'a b'"},
+		{"#a", "shell", "'#a'"},
+		{"a#", "shell", "a#"},
+		{"~a", "shell", "'~a'"},
+		{"{", "shell", "'{'"},
+		{"a{b}", "shell", "a{b}"},
+		{"it's", "shell", "\"it's\""},
+		{"it's $HOME", "shell", "'it'\\''s $HOME'"},
+		{"a\nb", "shell", "'a\nb'"},
+		{"a", "shell-always", "'a'"},
+		{"a\nb", "shell-escape", "'a'$'\\n''b'"},
+		{"\n", "shell-escape", "$'\\n'"},
+		{"a\x1b\x01b c", "shell-escape", "'a'$'\\033\\001''b c'"},
+		{"\xff", "shell-escape", "$'\\377'"},
+		{"a", "shell-escape-always", "'a'"},
+		{"日本", "shell-escape", "日本"},
+		{"a \"b\"\\", "c", "\"a \\\"b\\\"\\\\\""},
+		{"a\tb", "c", "\"a\\tb\""},
+		{"a b\n", "escape", "a\\ b\\n"},
+		{"a b", "locale", "‘a b’"},
+	}
+
+	for _, test := range tests {
+		quoted := quote_name(test.name, test.style, false)
+		if quoted != test.expected {
+			t.Logf("quote_name(%q, %q): expected %q, but got %q", test.name,
+				test.style, test.expected, quoted)
+			t.Fail()
+		}
+	}
+
+	// control characters are only hidden in the styles that don't escape them
+	check_output(t, quote_name("a\x1bb", "", true), "a?b")
+	check_output(t, quote_name("a\x1bb", "shell", true), "'a?b'")
+	check_output(t, quote_name("a\x1bb", "c", true), "\"a\\033b\"")
+	check_output(t, quote_name("é\xff", "", true), "é?")
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,138 @@
+package listing
+
+import (
+	"sort"
+	"strings"
+)
+
+// Given a slice of listings, return a new slice of listings with the
+// directories at the front of the slice, followed by the other listings.
+func sort_listings_dirs_first(listings []Listing) []Listing {
+
+	listings_sorted := make([]Listing, 0)
+
+	for _, l := range listings {
+		if l.Permissions[0] == 'd' {
+			listings_sorted = append(listings_sorted, l)
+		}
+	}
+	for _, l := range listings {
+		if l.Permissions[0] != 'd' {
+			listings_sorted = append(listings_sorted, l)
+		}
+	}
+
+	return listings_sorted
+}
+
+// A comparison function used for sorting Listings.  It returns a negative
+// number if a sorts before b, a positive number if b sorts before a, and 0 if
+// the two are equal under that key.
+type compare_function func(a, b Listing) int
+
+// Comparison function used for sorting Listings by name, ignoring case.  Names
+// that only differ in case are ordered bytewise, so that the result never
+// depends on the order the listings were read in.
+func compare_name(a, b Listing) int {
+	a_name_lower := strings.ToLower(a.Name)
+	b_name_lower := strings.ToLower(b.Name)
+
+	var smaller_len int
+	if len(a_name_lower) < len(b_name_lower) {
+		smaller_len = len(a_name_lower)
+	} else {
+		smaller_len = len(b_name_lower)
+	}
+
+	for i := 0; i < smaller_len; i++ {
+		if a_name_lower[i] < b_name_lower[i] {
+			return -1
+		} else if a_name_lower[i] > b_name_lower[i] {
+			return 1
+		}
+	}
+
+	if len(a_name_lower) < len(b_name_lower) {
+		return -1
+	} else if len(b_name_lower) < len(a_name_lower) {
+		return 1
+	}
+
+	return strings.Compare(a.Name, b.Name)
+}
+
+// Comparison function used for sorting Listings by the timestamp selected by
+// the Lister's options, from most recent to oldest.
+func (lister *Lister) compare_time(a, b Listing) int {
+	a_time := lister.listing_time(a)
+	b_time := lister.listing_time(b)
+
+	if a_time.After(b_time) {
+		return -1
+	} else if a_time.Before(b_time) {
+		return 1
+	}
+
+	return 0
+}
+
+// Comparison function used for sorting Listings by size, from largest to
+// smallest.
+func compare_size(a, b Listing) int {
+	if a.Size > b.Size {
+		return -1
+	} else if a.Size < b.Size {
+		return 1
+	}
+
+	return 0
+}
+
+// Compare a and b by each of the given keys in turn, returning the result of
+// the first key that tells them apart.
+func compare_keys(a, b Listing, keys []compare_function) int {
+	for _, key := range keys {
+		result := key(a, b)
+		if result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+// Return the sort keys selected by the Lister's options, from most to least
+// significant.  The name is always the last key, to break any ties.
+func (lister *Lister) sort_keys() []compare_function {
+	keys := make([]compare_function, 0)
+
+	if lister.options.SortTime {
+		keys = append(keys, lister.compare_time)
+	} else if lister.options.SortSize {
+		keys = append(keys, compare_size)
+	}
+
+	return append(keys, compare_name)
+}
+
+// Sort the given listings, taking into account the Lister's options.
+func (lister *Lister) sort_listings(listings []Listing) {
+	keys := lister.sort_keys()
+
+	sort.SliceStable(listings, func(i, j int) bool {
+		return compare_keys(listings[i], listings[j], keys) < 0
+	})
+
+	if lister.options.SortReverse {
+		for i, j := 0, len(listings)-1; i < j; i, j = i+1, j-1 {
+			listings[i], listings[j] = listings[j], listings[i]
+		}
+	}
+}
+
+// Sort the given listings in place, taking into account the Lister's options.
+func (lister *Lister) Sort(listings []Listing) {
+	lister.sort_listings(listings)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
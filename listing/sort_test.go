@@ -0,0 +1,44 @@
+package listing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Test sorting a large directory by time, where many entries share the same
+// modification time
+func Test_sort_listings_LargeTimeTies(t *testing.T) {
+	lister := &Lister{options: Options{SortTime: true}}
+
+	time_now := time.Now()
+	num_listings := 100000
+
+	// listings are created in reverse name order, with one of ten times
+	listings := make([]Listing, 0)
+	for i := num_listings - 1; i >= 0; i-- {
+		listings = append(listings, Listing{
+			Name:    fmt.Sprintf("%06d", i),
+			ModTime: time_now.Add(time.Duration(-(i % 10)) * time.Second),
+		})
+	}
+
+	lister.sort_listings(listings)
+
+	for i := 1; i < len(listings); i++ {
+		a := listings[i-1]
+		b := listings[i]
+
+		if a.ModTime.Before(b.ModTime) ||
+			(a.ModTime.Equal(b.ModTime) && a.Name > b.Name) {
+			t.Fatalf("listings %d (%s) and %d (%s) are out of order",
+				i-1, a.Name, i, b.Name)
+		}
+	}
+
+	check_output(t, listings[0].Name, "000000")
+	check_output(t, listings[len(listings)-1].Name,
+		fmt.Sprintf("%06d", num_listings-1))
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
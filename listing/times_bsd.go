@@ -0,0 +1,27 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package listing
+
+import (
+	"syscall"
+	"time"
+)
+
+// Return the access and status change times from the given stat result, as
+// laid out by macOS, FreeBSD and NetBSD.
+func access_change_times(stat *syscall.Stat_t) (time.Time, time.Time) {
+	return time.Unix(stat.Atimespec.Unix()), time.Unix(stat.Ctimespec.Unix())
+}
+
+// Return the birth time from the given stat result, or the zero time if the
+// filesystem doesn't record one, in which case it is given as 0 or -1.
+func birth_time(path string, stat *syscall.Stat_t) time.Time {
+	if stat.Birthtimespec.Sec <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(stat.Birthtimespec.Unix())
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
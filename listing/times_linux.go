@@ -0,0 +1,98 @@
+//go:build linux
+// +build linux
+
+package listing
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The statx(2) system call numbers, which the syscall package leaves out for
+// most architectures.  Birth times aren't available on any others.
+var sys_statx = map[string]uintptr{
+	"386":      383,
+	"amd64":    332,
+	"arm":      397,
+	"arm64":    291,
+	"loong64":  291,
+	"mips":     4366,
+	"mipsle":   4366,
+	"mips64":   5326,
+	"mips64le": 5326,
+	"ppc64":    383,
+	"ppc64le":  383,
+	"riscv64":  291,
+	"s390x":    379,
+}
+
+const (
+	at_fdcwd            = -100
+	at_symlink_nofollow = 0x100
+	statx_btime         = 0x800
+)
+
+// A timestamp in a struct statx.
+type statx_timestamp struct {
+	sec  int64
+	nsec uint32
+	_    int32
+}
+
+// The struct statx filled in by statx(2), which is 256 bytes in all.
+type statx_t struct {
+	mask            uint32
+	blksize         uint32
+	attributes      uint64
+	nlink           uint32
+	uid             uint32
+	gid             uint32
+	mode            uint16
+	_               uint16
+	ino             uint64
+	size            uint64
+	blocks          uint64
+	attributes_mask uint64
+	atime           statx_timestamp
+	btime           statx_timestamp
+	ctime           statx_timestamp
+	mtime           statx_timestamp
+	_               [128]byte
+}
+
+// Return the access and status change times from the given stat result.
+func access_change_times(stat *syscall.Stat_t) (time.Time, time.Time) {
+	return time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix())
+}
+
+// Return the birth time of the file at the given path, or the zero time if the
+// kernel or filesystem doesn't record one.  stat(2) has no birth time on Linux,
+// so this takes a call to statx(2).
+func birth_time(path string, stat *syscall.Stat_t) time.Time {
+	number, ok := sys_statx[runtime.GOARCH]
+	if !ok {
+		return time.Time{}
+	}
+
+	path_ptr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var stx statx_t
+	dirfd := at_fdcwd
+	_, _, errno := syscall.Syscall6(number,
+		uintptr(dirfd),
+		uintptr(unsafe.Pointer(path_ptr)),
+		at_symlink_nofollow, statx_btime,
+		uintptr(unsafe.Pointer(&stx)), 0)
+	if errno != 0 || stx.mask&statx_btime == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(stx.btime.sec, int64(stx.btime.nsec))
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
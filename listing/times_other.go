@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd
+// +build !linux,!darwin,!freebsd,!netbsd
+
+package listing
+
+import (
+	"syscall"
+	"time"
+)
+
+// Return the access and status change times from the given stat result, as
+// laid out by the other Unix systems, such as OpenBSD and Solaris.
+func access_change_times(stat *syscall.Stat_t) (time.Time, time.Time) {
+	return time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)),
+		time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
+}
+
+// Return the zero time, since the birth time isn't available here.
+func birth_time(path string, stat *syscall.Stat_t) time.Time {
+	return time.Time{}
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,228 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The named time styles accepted by Options.TimeStyle, besides "+FORMAT".
+var time_styles = []string{"full-iso", "long-iso", "iso", "locale", "relative"}
+
+// Return whether the given time style is one of the named styles or a
+// "+FORMAT" layout.
+func valid_time_style(style string) bool {
+	if style == "" || strings.HasPrefix(style, "+") {
+		return true
+	}
+
+	for _, s := range time_styles {
+		if style == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return whether the given time is recent, as ls decides between showing the
+// time of day or the year: within the last six months, and not in the future.
+func is_recent(t time.Time, now time.Time) bool {
+	six_months_ago := now.Add(-182 * 24 * time.Hour)
+
+	return t.After(six_months_ago) && t.Before(now.Add(5*time.Second))
+}
+
+// Format the given time in the given style (see Options.TimeStyle), for the
+// long format.
+func format_timestamp(t time.Time, style string, now time.Time) string {
+	switch style {
+	case "full-iso":
+		return strftime("%Y-%m-%d %H:%M:%S.%N %z", t)
+	case "long-iso":
+		return strftime("%Y-%m-%d %H:%M", t)
+	case "iso":
+		// the trailing space lines the year up with the time of day
+		if is_recent(t, now) {
+			return strftime("%m-%d %H:%M", t)
+		}
+		return strftime("%Y-%m-%d ", t)
+	case "relative":
+		return format_relative(t, now)
+	}
+
+	if strings.HasPrefix(style, "+") {
+		// as with GNU ls, a second layout after a newline is used for recent
+		// times, and the first for the rest
+		layouts := strings.SplitN(style[1:], "\n", 2)
+		if len(layouts) == 2 && is_recent(t, now) {
+			return strftime(layouts[1], t)
+		}
+		return strftime(layouts[0], t)
+	}
+
+	month, day, time_str := format_time(t, now)
+
+	return fmt.Sprintf("%s %s %5s", month, day, time_str)
+}
+
+// Return the given count with the singular or plural form of the given unit,
+// e.g. "1 day" or "2 days".
+func plural(count int64, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, unit)
+	}
+
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// Format the given time relative to now, e.g. "3h ago" or "2 days ago".  Times
+// in the future are given as e.g. "in 5m".
+func format_relative(t time.Time, now time.Time) string {
+	seconds := int64(now.Sub(t) / time.Second)
+
+	format := "%s ago"
+	if seconds < 0 {
+		format = "in %s"
+		seconds = -seconds
+	}
+
+	minutes := seconds / 60
+	hours := minutes / 60
+	days := hours / 24
+
+	var amount string
+	if seconds < 60 {
+		amount = fmt.Sprintf("%ds", seconds)
+	} else if minutes < 60 {
+		amount = fmt.Sprintf("%dm", minutes)
+	} else if hours < 24 {
+		amount = fmt.Sprintf("%dh", hours)
+	} else if days < 30 {
+		amount = plural(days, "day")
+	} else if days < 365 {
+		amount = plural(days/30, "month")
+	} else {
+		amount = plural(days/365, "year")
+	}
+
+	return fmt.Sprintf(format, amount)
+}
+
+// Format the given time according to a strftime(3) layout, as used by
+// "+FORMAT" time styles.  The conversions of the C and POSIX locales are
+// supported, along with GNU's %N for nanoseconds.  Unknown conversions are
+// copied to the output as they are.
+func strftime(layout string, t time.Time) string {
+	var output bytes.Buffer
+
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i+1 >= len(layout) {
+			output.WriteByte(layout[i])
+			continue
+		}
+
+		i++
+		switch layout[i] {
+		case 'a':
+			output.WriteString(t.Weekday().String()[0:3])
+		case 'A':
+			output.WriteString(t.Weekday().String())
+		case 'b', 'h':
+			output.WriteString(t.Month().String()[0:3])
+		case 'B':
+			output.WriteString(t.Month().String())
+		case 'c':
+			output.WriteString(strftime("%a %b %e %H:%M:%S %Y", t))
+		case 'C':
+			output.WriteString(fmt.Sprintf("%02d", t.Year()/100))
+		case 'd':
+			output.WriteString(fmt.Sprintf("%02d", t.Day()))
+		case 'D', 'x':
+			output.WriteString(strftime("%m/%d/%y", t))
+		case 'e':
+			output.WriteString(fmt.Sprintf("%2d", t.Day()))
+		case 'F':
+			output.WriteString(strftime("%Y-%m-%d", t))
+		case 'G':
+			year, _ := t.ISOWeek()
+			output.WriteString(fmt.Sprintf("%d", year))
+		case 'g':
+			year, _ := t.ISOWeek()
+			output.WriteString(fmt.Sprintf("%02d", year%100))
+		case 'H':
+			output.WriteString(fmt.Sprintf("%02d", t.Hour()))
+		case 'I':
+			output.WriteString(fmt.Sprintf("%02d", (t.Hour()+11)%12+1))
+		case 'j':
+			output.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case 'k':
+			output.WriteString(fmt.Sprintf("%2d", t.Hour()))
+		case 'l':
+			output.WriteString(fmt.Sprintf("%2d", (t.Hour()+11)%12+1))
+		case 'm':
+			output.WriteString(fmt.Sprintf("%02d", int(t.Month())))
+		case 'M':
+			output.WriteString(fmt.Sprintf("%02d", t.Minute()))
+		case 'n':
+			output.WriteString("\n")
+		case 'N':
+			output.WriteString(fmt.Sprintf("%09d", t.Nanosecond()))
+		case 'p':
+			if t.Hour() < 12 {
+				output.WriteString("AM")
+			} else {
+				output.WriteString("PM")
+			}
+		case 'P':
+			if t.Hour() < 12 {
+				output.WriteString("am")
+			} else {
+				output.WriteString("pm")
+			}
+		case 'r':
+			output.WriteString(strftime("%I:%M:%S %p", t))
+		case 'R':
+			output.WriteString(strftime("%H:%M", t))
+		case 's':
+			output.WriteString(fmt.Sprintf("%d", t.Unix()))
+		case 'S':
+			output.WriteString(fmt.Sprintf("%02d", t.Second()))
+		case 't':
+			output.WriteString("\t")
+		case 'T', 'X':
+			output.WriteString(strftime("%H:%M:%S", t))
+		case 'u':
+			output.WriteString(fmt.Sprintf("%d", (int(t.Weekday())+6)%7+1))
+		case 'U':
+			week := (t.YearDay() + 6 - int(t.Weekday())) / 7
+			output.WriteString(fmt.Sprintf("%02d", week))
+		case 'V':
+			_, week := t.ISOWeek()
+			output.WriteString(fmt.Sprintf("%02d", week))
+		case 'w':
+			output.WriteString(fmt.Sprintf("%d", int(t.Weekday())))
+		case 'W':
+			week := (t.YearDay() + 6 - (int(t.Weekday())+6)%7) / 7
+			output.WriteString(fmt.Sprintf("%02d", week))
+		case 'y':
+			output.WriteString(fmt.Sprintf("%02d", t.Year()%100))
+		case 'Y':
+			output.WriteString(fmt.Sprintf("%d", t.Year()))
+		case 'z':
+			output.WriteString(t.Format("-0700"))
+		case 'Z':
+			output.WriteString(t.Format("MST"))
+		case '%':
+			output.WriteString("%")
+		default:
+			output.WriteByte('%')
+			output.WriteByte(layout[i])
+		}
+	}
+
+	return output.String()
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,74 @@
+package listing
+
+import (
+	"testing"
+	"time"
+)
+
+// Test the strftime conversions used by "+FORMAT" time styles
+func Test_strftime(t *testing.T) {
+	tm := time.Date(2024, time.March, 5, 14, 7, 9, 12345, time.UTC)
+
+	layouts := map[string]string{
+		"%Y-%m-%d %H:%M:%S": "2024-03-05 14:07:09",
+		"%F %T.%N %z %Z":    "2024-03-05 14:07:09.000012345 +0000 UTC",
+		"%a %A %b %B":       "Tue Tuesday Mar March",
+		"%e|%k|%l|%I %p":    " 5|14| 2|02 PM",
+		"%j %u %w %U %W %V": "065 2 2 09 10 10",
+		"%D %R %y %C":       "03/05/24 14:07 24 20",
+		"%s":                "1709647629",
+		"100%% %q":          "100% %q",
+		"trailing %":        "trailing %",
+	}
+
+	for layout, expected := range layouts {
+		check_output(t, strftime(layout, tm), expected)
+	}
+}
+
+// Test each of the named time styles, and "+FORMAT" layouts with separate
+// layouts for recent and older times
+func Test_format_timestamp(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+	old := time.Date(2021, time.November, 30, 8, 0, 0, 0, time.UTC)
+
+	styles := map[string][2]string{
+		"":                 {"Mar 05 13:07", "Nov 30  2021"},
+		"locale":           {"Mar 05 13:07", "Nov 30  2021"},
+		"long-iso":         {"2024-03-05 13:07", "2021-11-30 08:00"},
+		"iso":              {"03-05 13:07", "2021-11-30 "},
+		"+%d.%m.%Y":        {"05.03.2024", "30.11.2021"},
+		"+%Y-%m-%d\n%H:%M": {"13:07", "2021-11-30"},
+		"full-iso": {"2024-03-05 13:07:09.000000000 +0000",
+			"2021-11-30 08:00:00.000000000 +0000"},
+	}
+
+	for style, expected := range styles {
+		check_output(t, format_timestamp(recent, style, now), expected[0])
+		check_output(t, format_timestamp(old, style, now), expected[1])
+	}
+}
+
+// Test the relative time style
+func Test_format_relative(t *testing.T) {
+	now := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+
+	times := map[time.Duration]string{
+		0:                         "0s ago",
+		-45 * time.Second:         "45s ago",
+		-3 * time.Minute:          "3m ago",
+		-3 * time.Hour:            "3h ago",
+		-25 * time.Hour:           "1 day ago",
+		-50 * time.Hour:           "2 days ago",
+		-65 * 24 * time.Hour:      "2 months ago",
+		-3 * 366 * 24 * time.Hour: "3 years ago",
+		5 * time.Minute:           "in 5m",
+	}
+
+	for offset, expected := range times {
+		check_output(t, format_relative(now.Add(offset), now), expected)
+	}
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,196 @@
+package listing
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The units that sizes are written in, as given by a block size such as "K",
+// "1MB" or "'1".  The zero value writes plain numbers of bytes.
+type BlockSize struct {
+	Bytes  uint64 // size of each unit in bytes, with 0 taken as 1
+	Suffix string // written after each size, e.g. "K" or "MiB"
+	Group  bool   // separate the thousands with commas
+	Human  bool   // scale each size to a human-readable unit instead
+	SI     bool   // with Human, scale by powers of 1000 rather than 1024
+}
+
+// The suffixes of human-readable sizes, for each power of 1024 (or 1000).
+var human_suffixes = []string{
+	"B", "K", "M", "G", "T", "P", "E", "Z", "Y", "R", "Q"}
+
+// The powers of 1024 (or 1000) given by each suffix of a block size.
+var block_size_powers = map[byte]int{
+	'K': 1, 'M': 2, 'G': 3, 'T': 4, 'P': 5, 'E': 6, 'Z': 7, 'Y': 8, 'R': 9,
+	'Q': 10,
+}
+
+// Parse a block size in the format used by GNU ls for --block-size and the
+// LS_BLOCK_SIZE and BLOCK_SIZE environment variables.  This is an optional
+// number followed by an optional suffix, where "K", "M", "G" and so on are
+// powers of 1024, as are "KiB", "MiB" and so on, while "KB", "MB" and so on
+// are powers of 1000.  A suffix without a number is also written after each
+// size.  A leading "'" separates the thousands, and "human-readable" and "si"
+// are the same as -h and --si.
+func ParseBlockSize(spec string) (BlockSize, error) {
+	var units BlockSize
+
+	size := spec
+	if strings.HasPrefix(size, "'") {
+		units.Group = true
+		size = size[1:]
+	}
+
+	if size == "human-readable" {
+		units.Human = true
+		return units, nil
+	} else if size == "si" {
+		units.Human = true
+		units.SI = true
+		return units, nil
+	}
+
+	if size == "" {
+		return units, fmt.Errorf("invalid block size '%s'", spec)
+	}
+
+	suffix := strings.TrimLeft(size, "0123456789")
+	number_str := size[:len(size)-len(suffix)]
+
+	number := uint64(1)
+	if number_str != "" {
+		var err error
+		number, err = strconv.ParseUint(number_str, 10, 64)
+		if err != nil || number == 0 {
+			return units, fmt.Errorf("invalid block size '%s'", spec)
+		}
+	}
+
+	multiplier := uint64(1)
+	if suffix != "" {
+		power, ok := block_size_powers[strings.ToUpper(suffix)[0]]
+		if !ok {
+			return units, fmt.Errorf("invalid block size '%s'", spec)
+		}
+
+		base := uint64(1024)
+		if suffix[1:] == "B" {
+			base = 1000
+		} else if suffix[1:] != "" && suffix[1:] != "iB" {
+			return units, fmt.Errorf("invalid block size '%s'", spec)
+		}
+
+		for i := 0; i < power; i++ {
+			if multiplier > math.MaxUint64/base {
+				return units, fmt.Errorf("block size '%s' is too large", spec)
+			}
+			multiplier *= base
+		}
+
+		if number_str == "" {
+			units.Suffix = suffix
+		}
+	}
+
+	if number > math.MaxUint64/multiplier {
+		return units, fmt.Errorf("block size '%s' is too large", spec)
+	}
+	units.Bytes = number * multiplier
+
+	return units, nil
+}
+
+// Separate the thousands of the given string of digits with commas, e.g.
+// "1234567" -> "1,234,567".
+func group_digits(digits string) string {
+	var grouped bytes.Buffer
+
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteRune(',')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return grouped.String()
+}
+
+// Format the given size in bytes with human-readable units, in powers of 1000
+// if si is set or 1024 otherwise (e.g. 1485 -> "1.5K").  As with GNU ls, sizes
+// are rounded up, and shown to one decimal place when less than 10 units, so
+// 1048575 and 1048576 are both "1.0M".
+func format_human(size_bytes uint64, si bool) string {
+	base := uint64(1024)
+	if si {
+		base = 1000
+	}
+
+	// find the largest unit that the size is at least one of
+	unit := uint64(1)
+	count := 0
+	for size_bytes/unit >= base && count < len(human_suffixes)-1 {
+		unit *= base
+		count++
+	}
+
+	whole, rest := size_bytes/unit, size_bytes%unit
+
+	size_str := ""
+	if count == 0 {
+		size_str = fmt.Sprintf("%d", size_bytes)
+	} else if whole < 10 {
+		tenths := whole*10 + (rest*10+unit-1)/unit
+		if tenths < 100 {
+			size_str = fmt.Sprintf("%d.%d", tenths/10, tenths%10)
+		} else {
+			size_str = "10"
+		}
+	} else {
+		if rest > 0 {
+			whole++
+		}
+		if whole == base && count < len(human_suffixes)-1 {
+			// e.g. 1023.5K rounds up to 1.0M
+			count++
+			size_str = "1.0"
+		} else {
+			size_str = fmt.Sprintf("%d", whole)
+		}
+	}
+
+	suffix := human_suffixes[count]
+	if si && suffix == "K" {
+		// the SI prefix for a thousand is a lowercase k
+		suffix = "k"
+	}
+
+	return size_str + suffix
+}
+
+// The units of the size column, as selected by the Lister's options.
+func (lister *Lister) size_units() BlockSize {
+	if lister.options.Human {
+		return BlockSize{Human: true}
+	}
+
+	return lister.options.SizeUnits
+}
+
+// The units of the -s column and the total line, as selected by the Lister's
+// options.  These are kibibytes unless chosen otherwise.
+func (lister *Lister) block_units() BlockSize {
+	if lister.options.Human {
+		return BlockSize{Human: true}
+	}
+
+	if lister.options.BlockUnits == (BlockSize{}) {
+		return BlockSize{Bytes: 1024}
+	}
+
+	return lister.options.BlockUnits
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
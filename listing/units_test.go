@@ -0,0 +1,82 @@
+package listing
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// Test parsing block sizes, in the formats accepted by GNU ls
+func Test_ParseBlockSize(t *testing.T) {
+	block_sizes := map[string]BlockSize{
+		"1":              {Bytes: 1},
+		"512":            {Bytes: 512},
+		"K":              {Bytes: 1024, Suffix: "K"},
+		"k":              {Bytes: 1024, Suffix: "k"},
+		"1K":             {Bytes: 1024},
+		"KiB":            {Bytes: 1024, Suffix: "KiB"},
+		"KB":             {Bytes: 1000, Suffix: "KB"},
+		"2MB":            {Bytes: 2000000},
+		"G":              {Bytes: 1 << 30, Suffix: "G"},
+		"'1":             {Bytes: 1, Group: true},
+		"'K":             {Bytes: 1024, Suffix: "K", Group: true},
+		"human-readable": {Human: true},
+		"si":             {Human: true, SI: true},
+	}
+
+	for spec, expected := range block_sizes {
+		units, err := ParseBlockSize(spec)
+		if err != nil {
+			t.Logf("ParseBlockSize(%q): %v", spec, err)
+			t.Fail()
+		}
+		check_output(t, fmt.Sprintf("%+v", units),
+			fmt.Sprintf("%+v", expected))
+	}
+
+	for _, spec := range []string{"", "'", "0", "x", "1X", "KiBB", "1Z", "Q"} {
+		_, err := ParseBlockSize(spec)
+		if err == nil {
+			t.Logf("ParseBlockSize(%q) should fail", spec)
+			t.Fail()
+		}
+	}
+}
+
+// Test formatting sizes in units of a block size, and in human-readable units
+func Test_format_size(t *testing.T) {
+	sizes := []struct {
+		size     uint64
+		units    BlockSize
+		expected string
+	}{
+		{1485, BlockSize{}, "1485"},
+		{1485, BlockSize{Bytes: 1024}, "2"},
+		{2048, BlockSize{Bytes: 1024, Suffix: "K"}, "2K"},
+		{1234567, BlockSize{Group: true}, "1,234,567"},
+		{123, BlockSize{Bytes: 1, Group: true}, "123"},
+		{1485, BlockSize{Human: true}, "1.5K"},
+		{1485, BlockSize{Human: true, SI: true}, "1.5k"},
+		{2000000, BlockSize{Human: true, SI: true}, "2.0M"},
+		{999999, BlockSize{Human: true, SI: true}, "1.0M"},
+		{1048575, BlockSize{Human: true}, "1.0M"},
+		{1048576, BlockSize{Human: true}, "1.0M"},
+		{1468 * 1024, BlockSize{Human: true}, "1.5M"},
+		{10239, BlockSize{Human: true}, "10K"},
+		{14337, BlockSize{Human: true}, "15K"},
+		{1023, BlockSize{Human: true}, "1023B"},
+		{0, BlockSize{Human: true}, "0B"},
+		{13, BlockSize{Human: true}, "13B"},
+		{math.MaxUint64, BlockSize{Human: true}, "16E"},
+		{math.MaxUint64, BlockSize{Human: true, SI: true}, "19E"},
+	}
+
+	for _, size := range sizes {
+		check_output(t, format_size(size.size, size.units), size.expected)
+	}
+
+	check_output(t, format_blocks(8, BlockSize{}), "4096")
+	check_output(t, format_blocks(8, BlockSize{Bytes: 1024}), "4")
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,176 @@
+package listing
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The ranges of characters that take two columns on a terminal: those with an
+// East Asian Width of Wide or Fullwidth, which include the emoji that are shown
+// as pictures by default.
+var wide_ranges = [][2]rune{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x2E99},
+	{0x2E9B, 0x2EF3}, {0x2F00, 0x2FD5}, {0x2FF0, 0x2FFF}, {0x3000, 0x303E},
+	{0x3041, 0x3096}, {0x3099, 0x30FF}, {0x3105, 0x312F}, {0x3131, 0x318E},
+	{0x3190, 0x31E3}, {0x31EF, 0x321E}, {0x3220, 0x3247}, {0x3250, 0x4DBF},
+	{0x4E00, 0xA48C}, {0xA490, 0xA4C6}, {0xA960, 0xA97C}, {0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF}, {0xFE10, 0xFE19}, {0xFE30, 0xFE52}, {0xFE54, 0xFE66},
+	{0xFE68, 0xFE6B}, {0xFF01, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x16FF0, 0x16FF1}, {0x17000, 0x187F7}, {0x18800, 0x18CD5},
+	{0x18D00, 0x18D08}, {0x1AFF0, 0x1AFFE}, {0x1B000, 0x1B122},
+	{0x1B132, 0x1B132}, {0x1B150, 0x1B152}, {0x1B155, 0x1B155},
+	{0x1B164, 0x1B167}, {0x1B170, 0x1B2FB}, {0x1F004, 0x1F004},
+	{0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A},
+	{0x1F200, 0x1F202}, {0x1F210, 0x1F23B}, {0x1F240, 0x1F248},
+	{0x1F250, 0x1F251}, {0x1F260, 0x1F265}, {0x1F300, 0x1F320},
+	{0x1F32D, 0x1F335}, {0x1F337, 0x1F37C}, {0x1F37E, 0x1F393},
+	{0x1F3A0, 0x1F3CA}, {0x1F3CF, 0x1F3D3}, {0x1F3E0, 0x1F3F0},
+	{0x1F3F4, 0x1F3F4}, {0x1F3F8, 0x1F43E}, {0x1F440, 0x1F440},
+	{0x1F442, 0x1F4FC}, {0x1F4FF, 0x1F53D}, {0x1F54B, 0x1F54E},
+	{0x1F550, 0x1F567}, {0x1F57A, 0x1F57A}, {0x1F595, 0x1F596},
+	{0x1F5A4, 0x1F5A4}, {0x1F5FB, 0x1F64F}, {0x1F680, 0x1F6C5},
+	{0x1F6CC, 0x1F6CC}, {0x1F6D0, 0x1F6D2}, {0x1F6D5, 0x1F6D7},
+	{0x1F6DC, 0x1F6DF}, {0x1F6EB, 0x1F6EC}, {0x1F6F4, 0x1F6FC},
+	{0x1F7E0, 0x1F7EB}, {0x1F7F0, 0x1F7F0}, {0x1F90C, 0x1F93A},
+	{0x1F93C, 0x1F945}, {0x1F947, 0x1F9FF}, {0x1FA70, 0x1FA7C},
+	{0x1FA80, 0x1FA88}, {0x1FA90, 0x1FABD}, {0x1FABF, 0x1FAC5},
+	{0x1FACE, 0x1FADB}, {0x1FAE0, 0x1FAE8}, {0x1FAF0, 0x1FAF8},
+	{0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// Characters with special meanings in grapheme clusters.
+const (
+	zero_width_joiner      = 0x200D
+	emoji_presentation     = 0xFE0F
+	emoji_modifier_first   = 0x1F3FB
+	emoji_modifier_last    = 0x1F3FF
+	regional_indicator_a   = 0x1F1E6
+	regional_indicator_z   = 0x1F1FF
+	hangul_jungseong_first = 0x1160
+	hangul_jongseong_last  = 0x11FF
+)
+
+// Return whether the given character takes two columns.
+func is_wide(r rune) bool {
+	i := sort.Search(len(wide_ranges), func(i int) bool {
+		return wide_ranges[i][1] >= r
+	})
+
+	return i < len(wide_ranges) && wide_ranges[i][0] <= r
+}
+
+// Return whether the given character takes no columns of its own: control
+// characters, and those that combine with the character before them, such as
+// accents and the vowels and final consonants of Hangul syllables.
+func is_zero_width(r rune) bool {
+	return unicode.IsControl(r) ||
+		unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) ||
+		r >= hangul_jungseong_first && r <= hangul_jongseong_last
+}
+
+// Return whether the given character is a regional indicator, a pair of which
+// makes up a flag.
+func is_regional_indicator(r rune) bool {
+	return r >= regional_indicator_a && r <= regional_indicator_z
+}
+
+// Return the index just past the ANSI escape sequence starting at s[i], such as
+// the colors around names (CSI, "ESC [ ... m") or hyperlinks (OSC, "ESC ] ...
+// ESC \").
+func skip_escape(s string, i int) int {
+	i++
+	if i >= len(s) {
+		return i
+	}
+
+	switch s[i] {
+	case '[':
+		// parameters and intermediate bytes, up to the final byte
+		for i++; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7E {
+				return i + 1
+			}
+		}
+	case ']':
+		// a string, terminated by BEL or ST ("ESC \")
+		for i++; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			} else if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	default:
+		return i + 1
+	}
+
+	return len(s)
+}
+
+// Return the number of columns the given string takes on a terminal.  ANSI
+// escape sequences take none, and each grapheme cluster (a character with any
+// combining marks, or an emoji sequence such as a flag or a family joined by
+// ZWJs) takes one column, or two if it is wide or shown as an emoji.
+func display_width(s string) int {
+	width := 0
+
+	// the width of the current grapheme cluster, whether a ZWJ has joined the
+	// next character to it, and whether it is a flag still missing its second
+	// regional indicator
+	cluster_width := 0
+	joined := false
+	half_flag := false
+
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			i = skip_escape(s, i)
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		if r == zero_width_joiner {
+			joined = cluster_width > 0
+			continue
+		} else if joined {
+			joined = false
+			continue
+		} else if r == emoji_presentation {
+			// a narrow symbol such as a heart, drawn as an emoji
+			if cluster_width == 1 {
+				cluster_width = 2
+				width++
+			}
+			continue
+		} else if r >= emoji_modifier_first && r <= emoji_modifier_last &&
+			cluster_width > 0 {
+			continue
+		} else if is_regional_indicator(r) && half_flag {
+			half_flag = false
+			continue
+		} else if is_zero_width(r) {
+			continue
+		}
+
+		cluster_width = 1
+		if is_wide(r) || is_regional_indicator(r) {
+			cluster_width = 2
+		}
+		half_flag = is_regional_indicator(r)
+		width += cluster_width
+	}
+
+	return width
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
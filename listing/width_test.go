@@ -0,0 +1,41 @@
+package listing
+
+import (
+	"testing"
+)
+
+// Test the number of columns taken by names with wide characters, combining
+// marks, emoji and escape sequences
+func Test_display_width(t *testing.T) {
+	widths := map[string]int{
+		"":                                       0,
+		"abc":                                    3,
+		"caf\u00e9":                              4,
+		"cafe\u0301":                             4,
+		"\u65e5\u672c\u8a9e":                     6,
+		"\uff21":                                 2,
+		"\ud55c\uad6d":                           4,
+		"\u1112\u1161\u11ab":                     2,
+		"\U0001f600":                             2,
+		"\u2764":                                 1,
+		"\u2764\ufe0f":                           2,
+		"\U0001f44d\U0001f3fd":                   2,
+		"\U0001f468\u200d\U0001f469":             2,
+		"\U0001f1ef\U0001f1f5":                   2,
+		"\U0001f1ef\U0001f1f5\U0001f1fa":         4,
+		"a\tb":                                   2,
+		"\x1b[01;34mdir\x1b[0m":                  3,
+		"\x1b]8;;file:///a\x1b\\a\x1b]8;;\x1b\\": 1,
+		"\x1b]8;;file:///a\aa\x1b]8;;\a":         1,
+	}
+
+	for s, expected := range widths {
+		if display_width(s) != expected {
+			t.Logf("display_width(%q): expected %d, but got %d", s,
+				expected, display_width(s))
+			t.Fail()
+		}
+	}
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+package listing
+
+import (
+	"bytes"
+	"syscall"
+	"unsafe"
+)
+
+// Call lgetxattr(2), which unlike syscall.Getxattr doesn't follow symlinks.
+// With an empty dest, only the size of the attribute is returned.
+func lgetxattr(path string, name string, dest []byte) (int, error) {
+	path_ptr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	name_ptr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var dest_ptr unsafe.Pointer
+	if len(dest) > 0 {
+		dest_ptr = unsafe.Pointer(&dest[0])
+	}
+
+	size, _, errno := syscall.Syscall6(syscall.SYS_LGETXATTR,
+		uintptr(unsafe.Pointer(path_ptr)),
+		uintptr(unsafe.Pointer(name_ptr)),
+		uintptr(dest_ptr), uintptr(len(dest)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return int(size), nil
+}
+
+// Call llistxattr(2), which unlike syscall.Listxattr doesn't follow symlinks.
+// With an empty dest, only the size of the list is returned.
+func llistxattr(path string, dest []byte) (int, error) {
+	path_ptr, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var dest_ptr unsafe.Pointer
+	if len(dest) > 0 {
+		dest_ptr = unsafe.Pointer(&dest[0])
+	}
+
+	size, _, errno := syscall.Syscall(syscall.SYS_LLISTXATTR,
+		uintptr(unsafe.Pointer(path_ptr)),
+		uintptr(dest_ptr), uintptr(len(dest)))
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return int(size), nil
+}
+
+// Return whether the file at the given path has the named extended attribute.
+func has_xattr(path string, name string) bool {
+	size, err := lgetxattr(path, name, nil)
+
+	return err == nil && size > 0
+}
+
+// Return the value of the named extended attribute of the file at the given
+// path, without any trailing NUL, or "" if it has none.
+func get_xattr(path string, name string) string {
+	size, err := lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return ""
+	}
+
+	value := make([]byte, size)
+	size, err = lgetxattr(path, name, value)
+	if err != nil {
+		return ""
+	}
+
+	return string(bytes.TrimRight(value[:size], "\x00"))
+}
+
+// Return the names and sizes of the extended attributes of the file at the
+// given path, in the order the filesystem lists them.
+func list_xattrs(path string) []Xattr {
+	xattrs := make([]Xattr, 0)
+
+	size, err := llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return xattrs
+	}
+
+	names := make([]byte, size)
+	size, err = llistxattr(path, names)
+	if err != nil {
+		return xattrs
+	}
+
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value_size, err := lgetxattr(path, string(name), nil)
+		if err != nil {
+			continue
+		}
+		xattrs = append(xattrs, Xattr{string(name), value_size})
+	}
+
+	return xattrs
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
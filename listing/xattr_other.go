@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package listing
+
+// Return whether the file at the given path has the named extended attribute,
+// which is always false here, as they are only read on Linux.
+func has_xattr(path string, name string) bool {
+	return false
+}
+
+// Return the value of the named extended attribute of the file at the given
+// path, which is always "" for none.
+func get_xattr(path string, name string) string {
+	return ""
+}
+
+// Return the names and sizes of the extended attributes of the file at the
+// given path, of which there are never any.
+func list_xattrs(path string) []Xattr {
+	return make([]Xattr, 0)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
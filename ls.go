@@ -1,1306 +1,391 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
+	"github.com/reganm/ls/listing"
 	"golang.org/x/crypto/ssh/terminal"
+	"io"
 	"io/ioutil"
-	"math"
 	"os"
-	"os/user"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
-// Base set of color codes for colorized output
-const (
-	color_fg_black   = 30
-	color_fg_red     = 31
-	color_fg_green   = 32
-	color_fg_brown   = 33
-	color_fg_blue    = 34
-	color_fg_magenta = 35
-	color_fg_cyan    = 36
-	color_fg_white   = 37
-	color_bg_black   = 40
-	color_bg_red     = 41
-	color_bg_green   = 42
-	color_bg_brown   = 43
-	color_bg_blue    = 44
-	color_bg_magenta = 45
-	color_bg_cyan    = 46
-	color_bg_white   = 47
-)
-
-// This a FileInfo paired with the original path as passed in to the program.
-// Unfortunately, the Name() in FileInfo is only the basename, so the associated
-// path must be manually recorded as well.
-type FileInfoPath struct {
-	path string
-	info os.FileInfo
-}
-
-// This struct wraps all the option settings for the program into a single
-// object.
-type Options struct {
-	all          bool
-	long         bool
-	human        bool
-	one          bool
-	dir          bool
-	color        bool
-	sort_reverse bool
-	sort_time    bool
-	sort_size    bool
-	help         bool
-	dirs_first   bool
-}
-
-// Listings contain all the information about a file or directory in a printable
-// form.
-type Listing struct {
-	permissions    string
-	num_hard_links string
-	owner          string
-	group          string
-	size           string
-	epoch_nano     int64
-	month          string
-	day            string
-	time           string
-	name           string
-	link_name      string
-	link_orphan    bool
-	is_socket      bool
-	is_pipe        bool
-	is_block       bool
-	is_character   bool
-}
-
-// Global variables used by multiple functions
-var (
-	user_map  map[int]string    // matches uid to username
-	group_map map[int]string    // matches gid to groupname
-	color_map map[string]string // matches file specification to output color
-	options   Options           // the state of all program options
-)
-
-// Helper function for get_color_from_bsd_code.  Given a flag to indicate
-// foreground/background and a single letter, return the correct partial ASCII
-// color code.
-func get_partial_color(foreground bool, letter uint8) string {
-	var partial_bytes bytes.Buffer
-
-	if foreground && letter == 'x' {
-		partial_bytes.WriteString("0;")
-	} else if !foreground && letter != 'x' {
-		partial_bytes.WriteString(";")
-	}
-
-	if foreground && letter >= 97 && letter <= 122 {
-		partial_bytes.WriteString("0;")
-	} else if foreground && letter >= 65 && letter <= 90 {
-		partial_bytes.WriteString("1;")
-	}
-
-	if letter == 'a' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_black))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_black))
-		}
-	} else if letter == 'b' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_red))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_red))
-		}
-	} else if letter == 'c' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_green))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_green))
-		}
-	} else if letter == 'd' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_brown))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_brown))
-		}
-	} else if letter == 'e' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_blue))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_blue))
-		}
-	} else if letter == 'f' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_magenta))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_magenta))
-		}
-	} else if letter == 'g' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_cyan))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_cyan))
-		}
-	} else if letter == 'h' {
-		if foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_fg_white))
-		} else if !foreground {
-			partial_bytes.WriteString(strconv.Itoa(color_bg_white))
-		}
-	} else if letter == 'A' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_black))
-	} else if letter == 'B' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_red))
-	} else if letter == 'C' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_green))
-	} else if letter == 'D' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_brown))
-	} else if letter == 'E' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_blue))
-	} else if letter == 'F' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_magenta))
-	} else if letter == 'G' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_cyan))
-	} else if letter == 'H' {
-		partial_bytes.WriteString(strconv.Itoa(color_fg_white))
-	}
-
-	return partial_bytes.String()
-}
-
-// Given a BSD LSCOLORS code like "ex", return the proper ASCII code
-// (like "\x1b[0;32m")
-func get_color_from_bsd_code(code string) string {
-	color_foreground := code[0]
-	color_background := code[1]
-
-	var color_bytes bytes.Buffer
-	color_bytes.WriteString("\x1b[")
-	color_bytes.WriteString(get_partial_color(true, color_foreground))
-	color_bytes.WriteString(get_partial_color(false, color_background))
-	color_bytes.WriteString("m")
-
-	return color_bytes.String()
+// Parse the program arguments and write the appropriate listings to the output
+// buffer, as they would appear on a terminal of the given width.
+func ls(output_buffer *bytes.Buffer, args []string, width int) error {
+	return ls_to(output_buffer, args, width, true, nil)
 }
 
-// Given an LSCOLORS string, fill in the appropriate keys and values of the
-// global color_map.
-func parse_LSCOLORS(LSCOLORS string) {
-	for i := 0; i < len(LSCOLORS); i += 2 {
-		if i == 0 {
-			color_map["directory"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 2 {
-			color_map["symlink"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 4 {
-			color_map["socket"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 6 {
-			color_map["pipe"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 8 {
-			color_map["executable"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 10 {
-			color_map["block"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 12 {
-			color_map["character"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 14 {
-			color_map["executable_suid"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 16 {
-			color_map["executable_sgid"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 18 {
-			color_map["directory_o+w_sticky"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		} else if i == 20 {
-			color_map["directory_o+w"] =
-				get_color_from_bsd_code(LSCOLORS[i : i+2])
-		}
+// Parse the program arguments and write the appropriate listings to the output
+// buffer.  As with GNU ls, output that isn't going to a terminal is listed one
+// entry per line without color, unless other options say otherwise.  If stdin
+// is given and isn't a terminal, the paths piped to it are listed along with
+// the ones in the program arguments.
+func ls_to(output_buffer *bytes.Buffer,
+	args []string,
+	width int,
+	is_terminal bool,
+	stdin *os.File) error {
+
+	arguments, err := parse_args(args)
+	if err != nil {
+		return err
 	}
-}
-
-// Write the given Listing's name to the output buffer, with the appropriate
-// formatting based on the current options.
-func write_listing_name(output_buffer *bytes.Buffer, l Listing) {
-
-	if options.color {
-		applied_color := false
-
-		num_hardlinks, _ := strconv.Atoi(l.num_hard_links)
-
-		// "file.name.txt" -> "*.txt"
-		name_split := strings.Split(l.name, ".")
-		extension_str := ""
-		if len(name_split) > 1 {
-			extension_str = fmt.Sprintf("*.%s", name_split[len(name_split)-1])
-		}
+	options := arguments.options
 
-		if extension_str != "" && color_map[extension_str] != "" {
-			output_buffer.WriteString(color_map[extension_str])
-			applied_color = true
-		} else if l.permissions[0] == 'd' &&
-			l.permissions[8] == 'w' && l.permissions[9] == 't' {
-			output_buffer.WriteString(color_map["directory_o+w_sticky"])
-			applied_color = true
-		} else if l.permissions[0] == 'd' && l.permissions[9] == 't' {
-			output_buffer.WriteString(color_map["directory_sticky"])
-			applied_color = true
-		} else if l.permissions[0] == 'd' && l.permissions[8] == 'w' {
-			output_buffer.WriteString(color_map["directory_o+w"])
-			applied_color = true
-		} else if l.permissions[0] == 'd' { // directory
-			output_buffer.WriteString(color_map["directory"])
-			applied_color = true
-		} else if num_hardlinks > 1 { // multiple hardlinks
-			output_buffer.WriteString(color_map["multi_hardlink"])
-			applied_color = true
-		} else if l.permissions[0] == 'l' && l.link_orphan { // orphan link
-			output_buffer.WriteString(color_map["link_orphan"])
-			applied_color = true
-		} else if l.permissions[0] == 'l' { // symlink
-			output_buffer.WriteString(color_map["symlink"])
-			applied_color = true
-		} else if l.permissions[3] == 's' { // setuid
-			output_buffer.WriteString(color_map["executable_suid"])
-			applied_color = true
-		} else if l.permissions[6] == 's' { // setgid
-			output_buffer.WriteString(color_map["executable_sgid"])
-			applied_color = true
-		} else if strings.Contains(l.permissions, "x") { // executable
-			output_buffer.WriteString(color_map["executable"])
-			applied_color = true
-		} else if l.is_socket { // socket
-			output_buffer.WriteString(color_map["socket"])
-			applied_color = true
-		} else if l.is_pipe { // pipe
-			output_buffer.WriteString(color_map["pipe"])
-			applied_color = true
-		} else if l.is_block { // block
-			output_buffer.WriteString(color_map["block"])
-			applied_color = true
-		} else if l.is_character { // character
-			output_buffer.WriteString(color_map["character"])
-			applied_color = true
-		}
-
-		output_buffer.WriteString(l.name)
-		if applied_color {
-			output_buffer.WriteString(color_map["end"])
-		}
-	} else {
-		output_buffer.WriteString(l.name)
+	if arguments.help {
+		output_buffer.WriteString(help_text())
+		return nil
 	}
 
-	if l.permissions[0] == 'l' && options.long {
-		if l.link_orphan {
-			output_buffer.WriteString(fmt.Sprintf(" -> %s%s%s",
-				color_map["link_orphan_target"],
-				l.link_name,
-				color_map["end"]))
-		} else {
-			output_buffer.WriteString(fmt.Sprintf(" -> %s", l.link_name))
-		}
+	//
+	// add any paths from --files-from or stdin
+	//
+	delimiter := byte('\n')
+	if arguments.null {
+		delimiter = 0
 	}
-}
 
-// Convert a FileInfoPath object to a Listing.  The dirname is passed for
-// following symlinks.
-func create_listing(dirname string, fip FileInfoPath) (Listing, error) {
-	var current_listing Listing
-
-	// permissions string
-	current_listing.permissions = fip.info.Mode().String()
-	if fip.info.Mode()&os.ModeSymlink == os.ModeSymlink {
-		current_listing.permissions = strings.Replace(
-			current_listing.permissions, "L", "l", 1)
-
-		var _pathstr string
-		if dirname == "" {
-			_pathstr = fmt.Sprintf("%s", fip.path)
-		} else {
-			_pathstr = fmt.Sprintf("%s/%s", dirname, fip.path)
-		}
-		link, err := os.Readlink(fmt.Sprintf(_pathstr))
-		if err != nil {
-			return current_listing, err
-		}
-		current_listing.link_name = link
-
-		// check to see if the symlink target exists
-		var _link_pathstr string
-		if dirname == "" {
-			_link_pathstr = fmt.Sprintf("%s", link)
-		} else {
-			_link_pathstr = fmt.Sprintf("%s/%s", dirname, link)
-		}
-		_, err = os.Open(_link_pathstr)
+	var input *os.File
+	if arguments.files_from == "-" {
+		input = stdin
+	} else if arguments.files_from != "" {
+		input, err = os.Open(arguments.files_from)
 		if err != nil {
-			if os.IsNotExist(err) {
-				current_listing.link_orphan = true
-			} else {
-				return current_listing, err
+			if path_err, ok := err.(*os.PathError); ok {
+				err = path_err.Err
 			}
+			return fmt.Errorf("cannot open '%s' for reading: %v",
+				arguments.files_from, err)
 		}
-	} else if current_listing.permissions[0] == 'D' {
-		current_listing.permissions = current_listing.permissions[1:]
-	} else if current_listing.permissions[0:2] == "ug" {
-		current_listing.permissions =
-			strings.Replace(current_listing.permissions, "ug", "-", 1)
-		current_listing.permissions = fmt.Sprintf("%ss%ss%s",
-			current_listing.permissions[0:3],
-			current_listing.permissions[4:6],
-			current_listing.permissions[7:])
-	} else if current_listing.permissions[0] == 'u' {
-		current_listing.permissions =
-			strings.Replace(current_listing.permissions, "u", "-", 1)
-		current_listing.permissions = fmt.Sprintf("%ss%s",
-			current_listing.permissions[0:3],
-			current_listing.permissions[4:])
-	} else if current_listing.permissions[0] == 'g' {
-		current_listing.permissions =
-			strings.Replace(current_listing.permissions, "g", "-", 1)
-		current_listing.permissions = fmt.Sprintf("%ss%s",
-			current_listing.permissions[0:6],
-			current_listing.permissions[7:])
-	} else if current_listing.permissions[0:2] == "dt" {
-		current_listing.permissions =
-			strings.Replace(current_listing.permissions, "dt", "d", 1)
-		current_listing.permissions = fmt.Sprintf("%st",
-			current_listing.permissions[0:len(current_listing.permissions)-1])
+		defer input.Close()
+	} else if stdin != nil && !terminal.IsTerminal(int(stdin.Fd())) {
+		input = stdin
 	}
 
-	sys := fip.info.Sys()
-
-	stat, ok := sys.(*syscall.Stat_t)
-	if !ok {
-		return current_listing, fmt.Errorf("syscall failed\n")
-	}
-
-	// number of hard links
-	num_hard_links := uint64(stat.Nlink)
-	current_listing.num_hard_links = fmt.Sprintf("%d", num_hard_links)
-
-	// owner
-	owner, err := user.LookupId(fmt.Sprintf("%d", stat.Uid))
-	if err != nil {
-		// if this causes an error, use the manual user_map
-		//
-		// this can happen if go is built using cross-compilation for multiple
-		// architectures (such as with Fedora Linux), in which case these
-		// OS-specific features aren't implemented
-		_owner := user_map[int(stat.Uid)]
-		if _owner == "" {
-			// if the user isn't in the map, just use the uid number
-			current_listing.owner = fmt.Sprintf("%d", stat.Uid)
-		} else {
-			current_listing.owner = _owner
+	if input != nil {
+		paths, err := read_paths(input, delimiter)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", input.Name(), err)
 		}
-	} else {
-		current_listing.owner = owner.Username
+		arguments.files = append(arguments.files, paths...)
 	}
 
-	// group
-	_group := group_map[int(stat.Gid)]
-	if _group == "" {
-		// if the group isn't in the map, just use the gid number
-		current_listing.group = fmt.Sprintf("%d", stat.Gid)
-	} else {
-		current_listing.group = _group
+	if arguments.width != -1 {
+		width = arguments.width
 	}
 
-	// size
-	if options.human {
-		size := float64(fip.info.Size())
-
-		count := 0
-		for size >= 1.0 {
-			size /= 1024
-			count++
+	// as with GNU ls, the units can also be chosen with LS_BLOCK_SIZE or
+	// BLOCK_SIZE, and -k only applies if they aren't set by an option
+	if !arguments.block_size {
+		block_size, ok := os.LookupEnv("LS_BLOCK_SIZE")
+		if !ok {
+			block_size, ok = os.LookupEnv("BLOCK_SIZE")
 		}
-
-		if count < 0 {
-			count = 0
-		} else if count > 0 {
-			size *= 1024
-			count--
+		if units, err := listing.ParseBlockSize(block_size); ok && err == nil {
+			options.SizeUnits = units
+			options.BlockUnits = units
 		}
 
-		var suffix string
-		if count == 0 {
-			suffix = "B"
-		} else if count == 1 {
-			suffix = "K"
-		} else if count == 2 {
-			suffix = "M"
-		} else if count == 3 {
-			suffix = "G"
-		} else if count == 4 {
-			suffix = "T"
-		} else if count == 5 {
-			suffix = "P"
-		} else if count == 6 {
-			suffix = "E"
-		} else {
-			suffix = "?"
-		}
-
-		size_str := ""
-		if count == 0 {
-			size_b := int64(size)
-			size_str = fmt.Sprintf("%d%s", size_b, suffix)
-		} else {
-			// looks like the printf formatting automatically rounds up
-			size_str = fmt.Sprintf("%.1f%s", size, suffix)
-		}
-
-		// drop the trailing .0 if it exists in the size
-		// e.g. 14.0K -> 14K
-		if len(size_str) > 3 &&
-			size_str[len(size_str)-3:len(size_str)-1] == ".0" {
-			size_str = size_str[0:len(size_str)-3] + suffix
-		}
-
-		current_listing.size = size_str
-
-	} else {
-		current_listing.size = fmt.Sprintf("%d", fip.info.Size())
-	}
-
-	// epoch_nano
-	current_listing.epoch_nano = fip.info.ModTime().UnixNano()
-
-	// month
-	current_listing.month = fip.info.ModTime().Month().String()[0:3]
-
-	// day
-	current_listing.day = fmt.Sprintf("%02d", fip.info.ModTime().Day())
-
-	// time
-	// if older than six months, print the year
-	// otherwise, print hour:minute
-	epoch_now := time.Now().Unix()
-	var seconds_in_six_months int64 = 182 * 24 * 60 * 60
-	epoch_six_months_ago := epoch_now - seconds_in_six_months
-	epoch_modified := fip.info.ModTime().Unix()
-
-	var time_str string
-	if epoch_modified <= epoch_six_months_ago ||
-		epoch_modified >= (epoch_now+5) {
-		time_str = fmt.Sprintf("%d", fip.info.ModTime().Year())
-	} else {
-		time_str = fmt.Sprintf("%02d:%02d",
-			fip.info.ModTime().Hour(),
-			fip.info.ModTime().Minute())
-	}
-
-	current_listing.time = time_str
-
-	current_listing.name = fip.path
-
-	// character?
-	if fip.info.Mode()&os.ModeCharDevice == os.ModeCharDevice {
-		current_listing.is_character = true
-	} else if fip.info.Mode()&os.ModeDevice == os.ModeDevice { // block?
-		current_listing.is_block = true
-	} else if fip.info.Mode()&os.ModeNamedPipe == os.ModeNamedPipe { // pipe?
-		current_listing.is_pipe = true
-	} else if fip.info.Mode()&os.ModeSocket == os.ModeSocket { // socket?
-		current_listing.is_socket = true
-	}
-
-	return current_listing, nil
-}
-
-// Given a slice of listings, return a new slice of listings with the
-// directories at the front of the slice, followed by the other listings.
-func sort_listings_dirs_first(listings []Listing) []Listing {
-
-	listings_sorted := make([]Listing, 0)
-
-	for _, l := range listings {
-		if l.permissions[0] == 'd' {
-			listings_sorted = append(listings_sorted, l)
-		}
-	}
-	for _, l := range listings {
-		if l.permissions[0] != 'd' {
-			listings_sorted = append(listings_sorted, l)
+		if arguments.kibibytes {
+			options.BlockUnits = listing.BlockSize{Bytes: 1024}
 		}
 	}
 
-	return listings_sorted
-}
-
-// Comparison function used for sorting Listings by name.
-func compare_name(a, b Listing) int {
-	a_name_lower := strings.ToLower(a.name)
-	b_name_lower := strings.ToLower(b.name)
+	warnings := make([]error, 0)
 
-	var smaller_len int
-	if len(a.name) < len(b.name) {
-		smaller_len = len(a.name)
-	} else {
-		smaller_len = len(b.name)
+	// without --tz, times are shown in time.Local, which is read from TZ when
+	// the program starts.  Only zone names and zone files are understood
+	// there, not POSIX rules such as "JST-9", and a zone that can't be loaded
+	// is silently taken to be UTC, so that is reported as a warning.
+	tz, ok := os.LookupEnv("TZ")
+	if ok && options.Location == nil && !valid_tz(tz) {
+		warnings = append(warnings, fmt.Errorf("unknown time zone in "+
+			"environment variable TZ, using UTC: '%s'", tz))
 	}
 
-	for i := 0; i < smaller_len; i++ {
-		if a_name_lower[i] < b_name_lower[i] {
-			return -1
-		} else if a_name_lower[i] > b_name_lower[i] {
-			return 1
+	// TIME_STYLE is used when there is no --time-style
+	if time_style := os.Getenv("TIME_STYLE"); time_style != "" &&
+		options.TimeStyle == "" {
+		options.TimeStyle, err = parse_time_style(time_style)
+		if err != nil {
+			return UsageError{fmt.Sprintf("invalid TIME_STYLE '%s'",
+				time_style)}
 		}
 	}
 
-	if len(a.name) < len(b.name) {
-		return -1
-	} else if len(b.name) < len(a.name) {
-		return 1
-	} else {
-		return 0
-	}
-}
-
-// Comparison function used for sorting Listings by modification time, from most
-// recent to oldest.
-func compare_time(a, b Listing) int {
-	if a.epoch_nano >= b.epoch_nano {
-		return -1
+	// without a layout from the arguments, columns are only used on a
+	// terminal
+	if arguments.format == "" && !is_terminal {
+		options.One = true
 	}
 
-	return 1
-}
-
-// Comparison function used for sorting Listings by size, from largest to
-// smallest.
-func compare_size(a, b Listing) int {
-	a_size, _ := strconv.Atoi(a.size)
-	b_size, _ := strconv.Atoi(b.size)
-
-	if a_size >= b_size {
-		return -1
+	// --classify=auto only marks types on a terminal
+	if arguments.classify && !is_terminal {
+		options.Indicator = ""
 	}
 
-	return 1
-}
-
-// Sort the given listings, taking into account the current program options.
-func sort_listings(listings []Listing) {
-	comparison_function := compare_name
-	if options.sort_time {
-		comparison_function = compare_time
-	} else if options.sort_size {
-		comparison_function = compare_size
+	// --hyperlink=auto likewise only links names on a terminal
+	if arguments.hyperlink && !is_terminal {
+		options.Hyperlink = false
 	}
 
-	for {
-		done := true
-		for i := 0; i < len(listings)-1; i++ {
-			a := listings[i]
-			b := listings[i+1]
-
-			if comparison_function(a, b) > -1 {
-				tmp := a
-				listings[i] = listings[i+1]
-				listings[i+1] = tmp
-				done = false
+	// as with GNU ls, names are quoted for the shell on a terminal, unless
+	// QUOTING_STYLE or an option chooses another style, and an invalid
+	// QUOTING_STYLE is ignored with a warning
+	if !arguments.quoting {
+		quoting_style := os.Getenv("QUOTING_STYLE")
+		if quoting_style != "" {
+			options.Quoting, err = parse_quoting_style(quoting_style)
+			if err != nil {
+				warnings = append(warnings, fmt.Errorf("ignoring invalid "+
+					"value of environment variable QUOTING_STYLE: '%s'",
+					quoting_style))
 			}
 		}
-		if done {
-			break
+		if options.Quoting == "" && is_terminal {
+			options.Quoting = "shell-escape"
 		}
 	}
 
-	if options.sort_reverse {
-		middle_index := (len(listings) / 2)
-		if len(listings)%2 == 0 {
-			middle_index--
-		}
-
-		for i := 0; i <= middle_index; i++ {
-			front_index := i
-			rear_index := len(listings) - 1 - i
-
-			if front_index == rear_index {
-				break
-			}
-
-			tmp := listings[front_index]
-			listings[front_index] = listings[rear_index]
-			listings[rear_index] = tmp
-		}
+	// control characters are hidden on a terminal, unless -q or
+	// --show-control-chars says otherwise
+	if arguments.control_chars == "" {
+		options.HideControl = is_terminal
 	}
-}
-
-// Create a set of Listings, comprised of the files and directories currently in
-// the given directory.
-func list_files_in_dir(dir Listing) ([]Listing, error) {
-	l := make([]Listing, 0)
-
-	if options.all {
-		//info_dot, err := os.Stat(dir.path)
-		info_dot, err := os.Stat(dir.name)
-		if err != nil {
-			return l, err
-		}
 
-		listing_dot, err := create_listing(dir.name,
-			FileInfoPath{".", info_dot})
-		if err != nil {
-			return l, err
-		}
+	//
+	// determine color output
+	//
+	LSCOLORS := os.Getenv("LSCOLORS")
+	LS_COLORS := os.Getenv("LS_COLORS")
+	color := arguments.color
 
-		info_dotdot, err := os.Stat(dir.name + "/..")
+	// a dircolors database takes the place of the environment variables
+	if arguments.dircolors != "" {
+		dircolors, err := read_dircolors(arguments.dircolors)
 		if err != nil {
-			return l, err
+			return err
 		}
+		LSCOLORS = ""
+		LS_COLORS = dircolors.LS_COLORS
+		warnings = append(warnings, dircolors.Errors...)
 
-		listing_dotdot, err := create_listing(dir.name,
-			FileInfoPath{"..", info_dotdot})
-		if err != nil {
-			return l, err
+		if color == "" && dircolors.Color == "all" {
+			color = "always"
+		} else if color == "" && dircolors.Color == "none" {
+			color = "never"
 		}
-
-		l = append(l, listing_dot)
-		l = append(l, listing_dotdot)
-	}
-
-	files_in_dir, err := ioutil.ReadDir(dir.name)
-	if err != nil {
-		return l, err
 	}
 
-	for _, f := range files_in_dir {
-		// if this is a .dotfile and '-a' is not specified, skip it
-		if []rune(f.Name())[0] == rune('.') && !options.all {
-			continue
-		}
-
-		_l, err := create_listing(dir.name,
-			FileInfoPath{f.Name(), f})
-		if err != nil {
-			return l, err
+	// without any colors set, the default LSCOLORS are used, except that a
+	// dircolors database with no colors for this terminal (e.g. when no TERM
+	// line matches $TERM) turns color off, as with dircolors
+	if LSCOLORS == "" && LS_COLORS == "" {
+		if arguments.dircolors != "" {
+			color = "never"
+		} else {
+			LSCOLORS = listing.DefaultLSCOLORS
 		}
-		l = append(l, _l)
 	}
 
-	sort_listings(l)
-
-	return l, nil
-}
-
-// Given a set of Listings, print them to the output buffer, taking into account
-// the current program arguments and terminal width as necessary.
-func write_listings_to_buffer(output_buffer *bytes.Buffer,
-	listings []Listing,
-	terminal_width int) {
-
-	if len(listings) == 0 {
-		return
+	if arguments.print_colors != "" {
+		output_buffer.WriteString(
+			color_settings(arguments.print_colors, LSCOLORS, LS_COLORS))
+		return with_warnings(nil, warnings)
 	}
 
-	if options.long {
-		var (
-			width_permissions    int = 0
-			width_num_hard_links int = 0
-			width_owner          int = 0
-			width_group          int = 0
-			width_size           int = 0
-			width_time           int = 0
-		)
-		// check max widths for each field
-		for _, l := range listings {
-			if len(l.permissions) > width_permissions {
-				width_permissions = len(l.permissions)
-			}
-			if len(l.num_hard_links) > width_num_hard_links {
-				width_num_hard_links = len(l.num_hard_links)
-			}
-			if len(l.owner) > width_owner {
-				width_owner = len(l.owner)
-			}
-			if len(l.group) > width_group {
-				width_group = len(l.group)
-			}
-			if len(l.size) > width_size {
-				width_size = len(l.size)
-			}
-			if len(l.time) > width_time {
-				width_time = len(l.time)
-			}
-		}
-
-		// now print the listings
-		for _, l := range listings {
-			// permissions
-			output_buffer.WriteString(l.permissions)
-			for i := 0; i < width_permissions-len(l.permissions); i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(" ")
-
-			// number of hard links (right justified)
-			for i := 0; i < width_num_hard_links-len(l.num_hard_links); i++ {
-				output_buffer.WriteString(" ")
-			}
-			for i := 0; i < 2-width_num_hard_links; i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(l.num_hard_links)
-			output_buffer.WriteString(" ")
-
-			// owner
-			output_buffer.WriteString(l.owner)
-			for i := 0; i < width_owner-len(l.owner); i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(" ")
-
-			// group
-			output_buffer.WriteString(l.group)
-			for i := 0; i < width_group-len(l.group); i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(" ")
-
-			// size
-			for i := 0; i < width_size-len(l.size); i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(l.size)
-			output_buffer.WriteString(" ")
-
-			// month
-			output_buffer.WriteString(l.month)
-			output_buffer.WriteString(" ")
-
-			// day
-			output_buffer.WriteString(l.day)
-			output_buffer.WriteString(" ")
-
-			// time
-			for i := 0; i < width_time-len(l.time); i++ {
-				output_buffer.WriteString(" ")
-			}
-			output_buffer.WriteString(l.time)
-			output_buffer.WriteString(" ")
-
-			// name
-			write_listing_name(output_buffer, l)
-			output_buffer.WriteString("\n")
-		}
-		if output_buffer.Len() > 0 {
-			output_buffer.Truncate(output_buffer.Len() - 1)
-		}
-	} else if options.one {
-		separator := "\n"
-
-		for _, l := range listings {
-			write_listing_name(output_buffer, l)
-			output_buffer.WriteString(separator)
-		}
-		if output_buffer.Len() > 0 {
-			output_buffer.Truncate(output_buffer.Len() - 1)
-		}
-	} else {
-		separator := "  "
-
-		// calculate the number of rows needed for column output
-		num_rows := 1
-		var col_widths []int
-		for {
-			num_cols_float := float64(len(listings)) / float64(num_rows)
-			num_cols_float = math.Ceil(num_cols_float)
-			num_cols := int(num_cols_float)
-
-			col_widths = make([]int, num_cols)
-			for i, _ := range col_widths {
-				col_widths[i] = 0
-			}
-
-			col_listings := make([]int, num_cols)
-			for i := 0; i < len(col_listings); i++ {
-				col_listings[i] = 0
-			}
-
-			// calculate necessary column widths
-			// also calculate the number of listings per column
-			for i := 0; i < len(listings); i++ {
-				col := i / num_rows
-				if col_widths[col] < len(listings[i].name) {
-					col_widths[col] = len(listings[i].name)
-				}
-				col_listings[col]++
-			}
-
-			// calculate the maximum width of each row
-			max_row_length := 0
-			for i := 0; i < num_cols; i++ {
-				max_row_length += col_widths[i]
-			}
-			max_row_length += len(separator) * (num_cols - 1)
-
-			if max_row_length > terminal_width && num_rows >= len(listings) {
-				break
-			} else if max_row_length > terminal_width {
-				num_rows++
-			} else {
-				listings_in_first_col := col_listings[0]
-				listings_in_last_col := col_listings[len(col_listings)-1]
-
-				// prevent short last (right-hand) columns
-				if listings_in_last_col <= listings_in_first_col/2 &&
-					listings_in_first_col-listings_in_last_col >= 5 {
-					num_rows++
-				} else {
-					break
-				}
-			}
-		}
-
-		for r := 0; r < num_rows; r++ {
-			for i, l := range listings {
-				if i%num_rows == r {
-					write_listing_name(output_buffer, l)
-					for s := 0; s < col_widths[i/num_rows]-len(l.name); s++ {
-						output_buffer.WriteString(" ")
-					}
-					output_buffer.WriteString(separator)
-				}
-			}
-			if len(listings) > 0 {
-				output_buffer.Truncate(output_buffer.Len() - len(separator))
-			}
-			output_buffer.WriteString("\n")
-		}
-		output_buffer.Truncate(output_buffer.Len() - 1)
+	options.Color = use_color(color, is_terminal)
+	if options.Color {
+		options.LSCOLORS = LSCOLORS
+		options.LS_COLORS = LS_COLORS
 	}
-}
-
-// Parse the program arguments and write the appropriate listings to the output
-// buffer.
-func ls(output_buffer *bytes.Buffer, args []string, width int) error {
-	args_options := make([]string, 0)
-	args_files := make([]string, 0)
-	list_dirs := make([]Listing, 0)
-	list_files := make([]Listing, 0)
 
-	//
-	// read in all the information from /etc/groups
-	//
-	group_map = make(map[int]string)
-
-	group_file, err := os.Open("/etc/group")
+	lister, err := listing.NewLister(options)
 	if err != nil {
-		return fmt.Errorf("could not open /etc/group for reading\n")
+		return err
 	}
 
-	reader := bufio.NewReader(group_file)
-	scanner := bufio.NewScanner(reader)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.Trim(line, " \t")
+	err = lister.List(output_buffer, arguments.files, width)
 
-		if line[0] == '#' || line == "" {
-			continue
-		}
-
-		line_split := strings.Split(line, ":")
+	return with_warnings(err, append(warnings, lister.ColorErrors()...))
+}
 
-		gid, err := strconv.ParseInt(line_split[2], 10, 0)
-		if err != nil {
-			return err
-		}
-		group_name := line_split[0]
-		group_map[int(gid)] = group_name
+// Add the given warnings, such as malformed color settings, to the errors from
+// a listing.  Warnings are reported like the listing's errors, but don't change
+// the exit status.
+func with_warnings(err error, warnings []error) error {
+	if len(warnings) == 0 {
+		return err
 	}
 
-	//
-	// read in all information from /etc/passwd for user lookup
-	//
-	user_map = make(map[int]string)
-
-	user_file, err := os.Open("/etc/passwd")
-	if err != nil {
-		return fmt.Errorf("could not open /etc/passwd for reading\n")
+	list_err, ok := err.(listing.ListError)
+	if err != nil && !ok {
+		return err
 	}
+	list_err.Errors = append(warnings, list_err.Errors...)
 
-	reader = bufio.NewReader(user_file)
-	scanner = bufio.NewScanner(reader)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.Trim(line, " \t")
-
-		if line[0] == '#' || line == "" {
-			continue
-		}
-
-		line_split := strings.Split(line, ":")
+	return list_err
+}
 
-		uid, err := strconv.ParseInt(line_split[2], 10, 0)
+// Return whether the given value of TZ can be loaded as time.Local: the name of
+// a zone in the time zone database, or the path of a zone file, either of which
+// may follow a ':'.
+func valid_tz(tz string) bool {
+	tz = strings.TrimPrefix(tz, ":")
+	if strings.HasPrefix(tz, "/") {
+		data, err := ioutil.ReadFile(tz)
 		if err != nil {
-			return err
+			return false
 		}
-		user_name := line_split[0]
-		user_map[int(uid)] = user_name
+		_, err = time.LoadLocationFromTZData(tz, data)
+		return err == nil
 	}
 
-	//
-	// parse arguments
-	//
-	for _, a := range args {
-		a_rune := []rune(a)
-		if a_rune[0] == '-' {
-			// add to the options list
-			args_options = append(args_options, a)
-		} else {
-			// add to the files/directories list
-			args_files = append(args_files, a)
-		}
-	}
-
-	//
-	// parse options
-	//
-	options = Options{}
-	options.color = true // use color by default
-	for _, o := range args_options {
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
 
-		// is it a short option '-' or a long option '--'?
-		if strings.Contains(o, "--") {
-			if strings.Contains(o, "--dirs-first") {
-				options.dirs_first = true
-			}
-			if strings.Contains(o, "--help") {
-				options.help = true
-			}
-			if strings.Contains(o, "--nocolor") {
-				options.color = false
-			}
-		} else {
-			if strings.Contains(o, "1") {
-				options.one = true
-			}
-			if strings.Contains(o, "a") {
-				options.all = true
-			}
-			if strings.Contains(o, "d") {
-				options.dir = true
-			}
-			if strings.Contains(o, "h") {
-				options.human = true
-			}
-			if strings.Contains(o, "l") {
-				options.long = true
-			}
-			if strings.Contains(o, "r") {
-				options.sort_reverse = true
-			}
-			if strings.Contains(o, "t") {
-				options.sort_time = true
-			}
-			if strings.Contains(o, "S") {
-				options.sort_size = true
-			}
+// Read the dircolors database at the given path, for the terminal named by
+// $TERM and $COLORTERM.
+func read_dircolors(path string) (listing.Dircolors, error) {
+	input, err := os.Open(path)
+	if err != nil {
+		if path_err, ok := err.(*os.PathError); ok {
+			err = path_err.Err
 		}
+		return listing.Dircolors{}, fmt.Errorf(
+			"cannot open '%s' for reading: %v", path, err)
 	}
+	defer input.Close()
 
-	if options.help {
-		help_str := "usage:  ls [OPTIONS] [FILES]\n\n" +
-			"OPTIONS:\n" +
-			"    --dirs-first  list directories first\n" +
-			"    --help        display usage information\n" +
-			"    --nocolor     remove color formatting\n" +
-			"    -1            one entry per line\n" +
-			"    -a            include entries starting with '.'\n" +
-			"    -d            list directories like files\n" +
-			"    -h            list sizes with human-readable units\n" +
-			"    -l            long listing\n" +
-			"    -r            reverse any sorting\n" +
-			"    -t            sort entries by modify time\n" +
-			"    -S            sort entries by size"
-		output_buffer.WriteString(help_str)
-		return nil
-	}
-
-	//
-	// determine color output
-	//
-
-	if options.color {
-		color_map = make(map[string]string)
-		color_map["end"] = "\x1b[0m"
-
-		LS_COLORS := os.Getenv("LS_COLORS")
-		LSCOLORS := os.Getenv("LSCOLORS")
-
-		if LSCOLORS != "" {
-			parse_LSCOLORS(LSCOLORS)
-		} else if LS_COLORS != "" {
-			// parse LS_COLORS
-			LS_COLORS_split := strings.Split(LS_COLORS, ":")
-			for _, i := range LS_COLORS_split {
-				if i == "" {
-					continue
-				}
-
-				i_split := strings.Split(i, "=")
-				color_code := fmt.Sprintf("\x1b[%sm", i_split[1])
-
-				if i_split[0] == "rs" {
-					color_map["end"] = color_code
-				} else if i_split[0] == "di" {
-					color_map["directory"] = color_code
-				} else if i_split[0] == "ln" {
-					color_map["symlink"] = color_code
-				} else if i_split[0] == "mh" {
-					color_map["multi_hardlink"] = color_code
-				} else if i_split[0] == "pi" {
-					color_map["pipe"] = color_code
-				} else if i_split[0] == "so" {
-					color_map["socket"] = color_code
-				} else if i_split[0] == "bd" {
-					color_map["block"] = color_code
-				} else if i_split[0] == "cd" {
-					color_map["character"] = color_code
-				} else if i_split[0] == "or" {
-					color_map["link_orphan"] = color_code
-				} else if i_split[0] == "mi" {
-					color_map["link_orphan_target"] = color_code
-				} else if i_split[0] == "su" {
-					color_map["executable_suid"] = color_code
-				} else if i_split[0] == "sg" {
-					color_map["executable_sgid"] = color_code
-				} else if i_split[0] == "tw" {
-					color_map["directory_o+w_sticky"] = color_code
-				} else if i_split[0] == "ow" {
-					color_map["directory_o+w"] = color_code
-				} else if i_split[0] == "st" {
-					color_map["directory_sticky"] = color_code
-				} else if i_split[0] == "ex" {
-					color_map["executable"] = color_code
-				} else {
-					color_map[i_split[0]] = color_code
-				}
+	return listing.ReadDircolors(input, path, os.Getenv("TERM"),
+		os.Getenv("COLORTERM"))
+}
 
-				// ca - CAPABILITY? -- not supported!
-				// do - DOOR -- not supported!
-			}
-		} else {
-			// use the default LSCOLORS
-			parse_LSCOLORS("exfxcxdxbxegedabagacad")
-		}
+// Return the shell commands that set the given format's color variable, "gnu"
+// for LS_COLORS or "bsd" for LSCOLORS, to the current colors.  LSCOLORS is
+// used before LS_COLORS, as when listing, and the colors are converted from one
+// form to the other as needed.
+func color_settings(format string, LSCOLORS string, LS_COLORS string) string {
+	name, value := "", ""
+	if format == "bsd" && LSCOLORS != "" {
+		name, value = "LSCOLORS", LSCOLORS
+	} else if format == "bsd" {
+		name, value = "LSCOLORS", listing.GNUToBSDColors(LS_COLORS)
+	} else if LSCOLORS != "" {
+		name, value = "LS_COLORS", listing.BSDToGNUColors(LSCOLORS)
+	} else {
+		name, value = "LS_COLORS", LS_COLORS
 	}
 
-	// if no files are specified, list the current directory
-	if len(args_files) == 0 {
-		this_dir, _ := os.Lstat(".")
-		//this_dir, _ := os.Stat(".")
-
-		this_dir_listing, err := create_listing("",
-			FileInfoPath{".", this_dir})
-		if err != nil {
-			return err
-		}
+	return fmt.Sprintf("%s='%s';\nexport %s", name,
+		strings.Replace(value, "'", "'\\''", -1), name)
+}
 
-		// for option_dir (-d), treat the '.' directory like a regular file
-		if options.dir {
-			list_files = append(list_files, this_dir_listing)
-		} else { // else, treat '.' like a directory
-			list_dirs = append(list_dirs, this_dir_listing)
-		}
+// Decide whether to use color, given the --color setting and whether the output
+// is a terminal.  In "auto" mode, which is the default, color is used on
+// terminals unless NO_COLOR is set or CLICOLOR is 0, and is used even when
+// piped if CLICOLOR_FORCE is set.  See https://no-color.org and
+// https://bixense.com/clicolors.
+func use_color(when string, is_terminal bool) bool {
+	if when == "" {
+		when = "auto"
 	}
 
-	//
-	// separate the files from the directories
-	//
-	for _, f := range args_files {
-		//info, err := os.Stat(f)
-		info, err := os.Lstat(f)
-
-		if err != nil && os.IsNotExist(err) {
-			return fmt.Errorf("cannot access %s: no such file or directory", f)
-		} else if err != nil && os.IsPermission(err) {
-			return fmt.Errorf("open %s: permission denied", f)
-		} else if err != nil {
-			return err
-		}
-
-		f_listing, err := create_listing("",
-			FileInfoPath{f, info})
-		if err != nil {
-			return err
-		}
-
-		// for option_dir (-d), treat directories like regular files
-		if options.dir {
-			list_files = append(list_files, f_listing)
-		} else { // else, separate the files and directories
-			if info.IsDir() {
-				list_dirs = append(list_dirs, f_listing)
-			} else {
-				list_files = append(list_files, f_listing)
-			}
-		}
+	if when == "always" {
+		return true
+	} else if when == "never" {
+		return false
 	}
 
-	num_files := len(list_files)
-	num_dirs := len(list_dirs)
-
-	// sort the lists if necessary
-	sort_listings(list_files)
-	sort_listings(list_dirs)
-
-	//
-	// list the files first (unless --dirs-first)
-	//
-	if num_files > 0 && !options.dirs_first {
-		write_listings_to_buffer(output_buffer,
-			list_files,
-			width)
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	} else if force := os.Getenv("CLICOLOR_FORCE"); force != "" &&
+		force != "0" {
+		return true
+	} else if os.Getenv("CLICOLOR") == "0" {
+		return false
 	}
 
-	//
-	// then list the directories
-	//
-	if (num_files > 0 && num_dirs > 0) || (num_dirs > 1) {
-		if num_files > 0 && !options.dirs_first {
-			output_buffer.WriteString("\n\n")
-		}
-
-		for _, d := range list_dirs {
-			write_listing_name(output_buffer, d)
-			output_buffer.WriteString(":\n")
-
-			listings, err := list_files_in_dir(d)
-			if err != nil {
-				return err
-			}
-
-			if options.dirs_first {
-				listings = sort_listings_dirs_first(listings)
-			}
+	return is_terminal
+}
 
-			if len(listings) > 0 {
-				write_listings_to_buffer(output_buffer,
-					listings,
-					width)
-				output_buffer.WriteString("\n\n")
-			} else {
-				output_buffer.WriteString("\n")
-			}
-		}
+// Return the width of the output on the given file descriptor, and whether it
+// is a terminal.  If the terminal's size can't be found (e.g. when the output
+// is piped to another program), the width is taken from the COLUMNS
+// environment variable, or else defaults to 80.
+func output_width(fd int) (int, bool) {
+	is_terminal := terminal.IsTerminal(fd)
 
-		output_buffer.Truncate(output_buffer.Len() - 2)
-	} else if num_dirs == 1 {
-		for _, d := range list_dirs {
+	width, _, err := terminal.GetSize(fd)
+	if err == nil && width > 0 {
+		return width, is_terminal
+	}
 
-			listings, err := list_files_in_dir(d)
-			if err != nil {
-				return err
-			}
+	columns, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err == nil && columns > 0 {
+		return columns, is_terminal
+	}
 
-			if options.dirs_first {
-				listings = sort_listings_dirs_first(listings)
-			}
+	return 80, is_terminal
+}
 
-			write_listings_to_buffer(output_buffer,
-				listings,
-				width)
-		}
+// Read the list of paths from the given input, one per line, or separated by
+// NUL bytes if the delimiter is 0 (e.g. from 'find -print0').  Empty paths are
+// skipped.
+func read_paths(input io.Reader, delimiter byte) ([]string, error) {
+	input_bytes, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
 	}
 
-	//
-	// list the files now if --dirs-first
-	//
-	if num_files > 0 && options.dirs_first {
-		if num_dirs > 0 {
-			output_buffer.WriteString("\n\n")
+	paths := make([]string, 0)
+	for _, path := range strings.Split(string(input_bytes), string(delimiter)) {
+		if path != "" {
+			paths = append(paths, path)
 		}
-		write_listings_to_buffer(output_buffer,
-			list_files,
-			width)
 	}
 
-	return nil
+	return paths, nil
 }
 
 // Main function
 func main() {
-	// capture the current terminal dimensions
-	terminal_width, _, err := terminal.GetSize(int(os.Stdout.Fd()))
-	if err != nil {
-		fmt.Printf("error getting terminal dimensions\n")
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
-	}
-
-	var argument_list []string
-
-	// If stdin is not a terminal, that indicates that arguments are being sent
-	// via a pipe (e.g.  echo "something" | ls).  Need to include these with the
-	// other program arguments.
-	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
-		stdin_bytes, err := ioutil.ReadAll(os.Stdin)
-		if err != nil {
-			fmt.Printf("error reading from stdin\n")
-			os.Exit(1)
-		}
-
-		stdin_str := string(stdin_bytes)
+	terminal_width, is_terminal := output_width(int(os.Stdout.Fd()))
 
-		// remove leading/trailing whitespace
-		stdin_str = strings.TrimSpace(stdin_str)
+	var output_buffer bytes.Buffer
 
-		// remove tab characters
-		stdin_str = strings.Replace(stdin_str, "\t", "", -1)
+	err := ls_to(&output_buffer, os.Args[1:], terminal_width, is_terminal,
+		os.Stdin)
 
-		// remove internal excess spaces
-		var removed_space bool
-		for {
-			removed_space = false
-			if strings.Contains(stdin_str, "  ") {
-				stdin_str = strings.Replace(stdin_str, "  ", " ", -1)
-				removed_space = true
-			}
-			if !removed_space {
-				break
-			}
+	// as with GNU ls, exit with status 1 for minor problems (e.g. a
+	// subdirectory that can't be read), and 2 for serious trouble (e.g. a
+	// missing command line argument or an invalid option)
+	exit_status := 0
+	if _, ok := err.(UsageError); ok {
+		fmt.Fprintf(os.Stderr, "ls: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Try 'ls --help' for more information.\n")
+		os.Exit(2)
+	} else if list_err, ok := err.(listing.ListError); ok {
+		// report each path that couldn't be listed, then list the rest
+		for _, e := range list_err.Errors {
+			fmt.Fprintf(os.Stderr, "ls: %v\n", e)
 		}
-
-		stdin_str_slice := strings.Split(stdin_str, " ")
-
-		// create a new argument list with the regular arguments followed by the
-		// stdin arguments
-		argument_list = append(os.Args, stdin_str_slice...)
-	} else {
-		argument_list = os.Args
-	}
-
-	var output_buffer bytes.Buffer
-
-	err = ls(&output_buffer, argument_list[1:], terminal_width)
-	if err != nil {
-		fmt.Printf("ls: %v\n", err)
-		os.Exit(1)
+		exit_status = list_err.Status
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "ls: %v\n", err)
+		os.Exit(2)
 	}
 
 	if output_buffer.String() != "" {
 		fmt.Printf("%s\n", output_buffer.String())
 	}
+
+	os.Exit(exit_status)
 }
 
 // vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/reganm/ls/listing"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Test running 'ls -@' and 'ls -Z', and the "+" that marks a file with an ACL
+func Test_xattrs_Files(t *testing.T) {
+	setup_test_dir("xattrs_Files")
+
+	time_now := time.Now()
+	_mkfile2("a", 0644, os.Getuid(), os.Getgid(), 13, time_now)
+	_mkfile2("b", 0644, os.Getuid(), os.Getgid(), 13, time_now)
+
+	err := syscall.Setxattr("a", "user.test", []byte("hello"), 0)
+	if err != nil {
+		t.Skipf("extended attributes aren't supported here: %v", err)
+	}
+
+	// an ACL granting read access to root, along with the usual entries
+	var acl bytes.Buffer
+	binary.Write(&acl, binary.LittleEndian, uint32(2))
+	for _, entry := range [][3]uint32{
+		{0x01, 6, 0xffffffff}, // owner
+		{0x02, 4, 0},          // user root
+		{0x04, 4, 0xffffffff}, // group
+		{0x10, 4, 0xffffffff}, // mask
+		{0x20, 4, 0xffffffff}, // other
+	} {
+		binary.Write(&acl, binary.LittleEndian, uint16(entry[0]))
+		binary.Write(&acl, binary.LittleEndian, uint16(entry[1]))
+		binary.Write(&acl, binary.LittleEndian, entry[2])
+	}
+	err = syscall.Setxattr("b", "system.posix_acl_access", acl.Bytes(), 0)
+	if err != nil {
+		t.Skipf("ACLs aren't supported here: %v", err)
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"-@", "a", "b"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	check_output(t, output,
+		"a\n\tuser.test\t5\nb\n\tsystem.posix_acl_access\t44")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-Z", "a"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	check_output(t, output, "? a")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-ngZ", "b"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	date := fmt.Sprintf("%s %02d %02d:%02d", time_now.Month().String()[0:3],
+		time_now.Day(), time_now.Hour(), time_now.Minute())
+	expected := fmt.Sprintf("-rw-r--r--+ 1 %d ? 13 %s b", os.Getgid(), date)
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+
+	// ACLs are only looked for when they would be shown
+	for _, long := range []bool{false, true} {
+		lister, err := listing.NewLister(listing.Options{Long: long})
+		if err != nil {
+			t.Fatalf("NewLister: %v", err)
+		}
+		l, err := lister.Stat("b")
+		if err != nil {
+			t.Fatalf("Stat(b): %v", err)
+		}
+
+		expected := "-rw-r--r--"
+		if long {
+			expected += "+"
+		}
+		check_output(t, l.Permissions, expected)
+	}
+
+	// the names of attributes are quoted like file names
+	err = syscall.Setxattr("a", "user.\x1b[31mred", []byte("x"), 0)
+	if err != nil {
+		t.Fatalf("syscall.Setxattr(a): %v", err)
+	}
+
+	output_buffer.Reset()
+	args = []string{"-@", "a"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(),
+		"a\n\tuser.test\t5\n\t'user.'$'\\033''[31mred'\t1")
+	check_error_nil(t, ls_err)
+}
+
+// vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80
@@ -3,11 +3,15 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/reganm/ls/listing"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"os/user"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -15,6 +19,12 @@ import (
 // the root directory where individual test subdirectories are stored.
 var test_root string
 
+// uid and gid lookup tables, for building the expected long listings
+var (
+	user_map  map[int]string
+	group_map map[int]string
+)
+
 // default terminal width
 const tw = 80
 
@@ -74,6 +84,17 @@ func _mklink(path_target string, path_linkname string) {
 	}
 }
 
+// Create a named pipe at the given path.  syscall.Mkfifo isn't available on
+// every Unix system, so the mkfifo utility is used instead.
+func _mkfifo(path string) {
+	err := exec.Command("mkfifo", "-m", "0600", path).Run()
+	if err != nil {
+		fmt.Printf("error: mkfifo %s\n", path)
+		fmt.Printf("\t%v\n", err)
+		os.Exit(1)
+	}
+}
+
 // Perform the necessary Chmod, Chown, and Chtimes on the given path
 func _modify_path(path string,
 	mode os.FileMode,
@@ -158,11 +179,82 @@ func _mkdir2(path string,
 	_modify_path(path, mode, uid, gid, mod_epoch_s)
 }
 
+// create a file with the given contents to stand in for piped stdin, and open
+// it for reading
+func _mkstdin(t *testing.T, contents string) *os.File {
+	err := ioutil.WriteFile(".stdin", []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, err := os.Open(".stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stdin
+}
+
+// return the number of blocks allocated to the given paths, as 'ls -l' prints
+// it in the "total" line
+func _total(human bool, paths ...string) string {
+	var blocks int64
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			fmt.Printf("error: os.Lstat(%s)\n", path)
+			fmt.Printf("\t%v\n", err)
+			os.Exit(1)
+		}
+		blocks += int64(info.Sys().(*syscall.Stat_t).Blocks)
+	}
+
+	if !human {
+		return fmt.Sprintf("%d", (blocks*512+1023)/1024)
+	}
+
+	// rounded up like GNU ls, to one decimal place below 10 units
+	size := blocks * 512
+	unit := int64(1)
+	suffix := 0
+	for size/unit >= 1024 {
+		unit *= 1024
+		suffix++
+	}
+	if suffix == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	whole := size / unit
+	if whole < 10 {
+		tenths := (size*10 + unit - 1) / unit
+		if tenths < 100 {
+			return fmt.Sprintf("%d.%d%c", tenths/10, tenths%10,
+				"BKMGTPE"[suffix])
+		}
+		return fmt.Sprintf("10%c", "BKMGTPE"[suffix])
+	}
+	whole = (size + unit - 1) / unit
+	if whole == 1024 {
+		return fmt.Sprintf("1.0%c", "BKMGTPE"[suffix+1])
+	}
+
+	return fmt.Sprintf("%d%c", whole, "BKMGTPE"[suffix])
+}
+
 // change to the test_root, create a directory for the test, and change to that
 // directory
 func setup_test_dir(path string) {
 	os.Setenv("LSCOLORS", "")
 	os.Setenv("LS_COLORS", "")
+	os.Unsetenv("NO_COLOR")
+	os.Unsetenv("CLICOLOR")
+	os.Unsetenv("CLICOLOR_FORCE")
+	os.Unsetenv("TIME_STYLE")
+	os.Unsetenv("TZ")
+	os.Unsetenv("LS_BLOCK_SIZE")
+	os.Unsetenv("BLOCK_SIZE")
+	os.Unsetenv("QUOTING_STYLE")
 	_cd(test_root)
 	_mkdir(path)
 	_cd(path)
@@ -191,6 +283,19 @@ func check_error_nil(t *testing.T, err error) {
 	}
 }
 
+// fail the given test if err is not a ListError with the expected exit status
+func check_exit_status(t *testing.T, err error, expected int) {
+	list_err, ok := err.(listing.ListError)
+	if !ok {
+		t.Logf("error is not a ListError: %v\n", err)
+		t.Fail()
+	} else if list_err.Status != expected {
+		t.Logf("expected exit status %d, but got %d\n", expected,
+			list_err.Status)
+		t.Fail()
+	}
+}
+
 // remove any consecutive spaces in the given bytes.Buffer, and return the
 // sanitized string
 func clean_output_buffer(buffer bytes.Buffer) string {
@@ -229,6 +334,21 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
+	// read in the same user and group names that ls will use
+	user_map, err = listing.ReadUserMap()
+	if err != nil {
+		fmt.Printf("error:  couldn't read the user map\n")
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	group_map, err = listing.ReadGroupMap()
+	if err != nil {
+		fmt.Printf("error:  couldn't read the group map\n")
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
 	//
 	// run the tests
 	//
@@ -411,6 +531,90 @@ func Test_None_Dir_DirPerms(t *testing.T) {
 	check_error(t, err, "open test_dir/a: permission denied")
 }
 
+// Test running 'ls -l' and 'ls -s' on a directory that can't be read, which
+// should only report the error, without a total line
+func Test_l_Dir_DirPerms(t *testing.T) {
+	setup_test_dir("l_Dir_DirPerms")
+
+	_mkdir("test_dir")
+	_mkfile("test_dir/a")
+	_mkdir("other_dir")
+	_modify_path("test_dir", 0000, os.Getuid(), os.Getgid(), time.Now())
+
+	tests := map[string]string{
+		"-l test_dir":           "",
+		"-s test_dir":           "",
+		"-l test_dir other_dir": "other_dir:\ntotal 0\n\ntest_dir:",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := append([]string{"--nocolor"}, strings.Fields(arg)...)
+		ls_err := ls(&output_buffer, args, tw)
+
+		if output_buffer.String() != expected {
+			t.Logf("ls %s: expected %q, but got %q", arg, expected,
+				output_buffer.String())
+			t.Fail()
+		}
+		check_error(t, ls_err, "open test_dir: permission denied")
+		check_exit_status(t, ls_err, 2)
+	}
+
+	// reset test_dir permissions so the directory can be deleted
+	_modify_path("test_dir", 0755, os.Getuid(), os.Getgid(), time.Now())
+}
+
+// Test running 'ls a b c' when 'b' does not exist, which should still list 'a'
+// and 'c'
+func Test_None_Files_Missing(t *testing.T) {
+	setup_test_dir("None_Files_Missing")
+
+	_mkfile("a")
+	_mkfile("c")
+
+	var output_buffer bytes.Buffer
+	args := []string{"a", "b", "c"}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := "a c"
+
+	check_output(t, output, expected)
+	check_error(t, err, "cannot access b: no such file or directory")
+	check_exit_status(t, err, 2)
+}
+
+// Test running 'ls -R' with a subdirectory that can't be read, which should be
+// reported while the rest of the tree is listed
+func Test_R_None_DirPerms(t *testing.T) {
+	setup_test_dir("R_None_DirPerms")
+
+	_mkdir("dir1")
+	_mkfile("dir1/a")
+	_mkdir("dir2")
+	_mkfile("dir2/b")
+	_modify_path("dir1", 0000, os.Getuid(), os.Getgid(), time.Now())
+
+	var output_buffer bytes.Buffer
+	args := []string{"-R", "--nocolor"}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	// reset dir1 permissions so the directory can be deleted
+	_modify_path("dir1", 0755, os.Getuid(), os.Getgid(), time.Now())
+
+	expected := ".:\n" +
+		"dir1 dir2\n\n" +
+		"./dir1:\n\n" +
+		"./dir2:\n" +
+		"b"
+
+	check_output(t, output, expected)
+	check_error(t, err, "open ./dir1: permission denied")
+	check_exit_status(t, err, 1)
+}
+
 // Test running 'ls -a' in an empty directory
 func Test_a_None_Empty(t *testing.T) {
 	setup_test_dir("a_None_Empty")
@@ -523,7 +727,7 @@ func Test_l_None_Empty(t *testing.T) {
 	err := ls(&output_buffer, args, tw)
 	output := clean_output_buffer(output_buffer)
 
-	expected := ""
+	expected := "total 0"
 
 	check_output(t, output, expected)
 	check_error_nil(t, err)
@@ -650,8 +854,10 @@ func Test_l_File_Link2(t *testing.T) {
 
 	group := group_map[os.Getgid()]
 
-	expected := fmt.Sprintf(
+	// the "total" line is left with just the number of blocks
+	expected := fmt.Sprintf("%s\n"+
 		"1 %s %s %d %s %02d %02d:%02d a\n1 %s %s 1 %s %02d %02d:%02d b -> %s",
+		_total(false, "a", "b"),
 		owner,
 		group,
 		size,
@@ -1034,7 +1240,9 @@ func Test_lh_None_File(t *testing.T) {
 
 	group := group_map[os.Getgid()]
 
-	expected := fmt.Sprintf("-rw------- 1 %s %s %dB %s %02d %02d:%02d %s",
+	expected := fmt.Sprintf("total %s\n"+
+		"-rw------- 1 %s %s %dB %s %02d %02d:%02d %s",
+		_total(true, path),
 		owner,
 		group,
 		size,
@@ -1074,7 +1282,9 @@ func Test_lh_None_File2(t *testing.T) {
 
 	group := group_map[os.Getgid()]
 
-	expected := fmt.Sprintf("-rw------- 1 %s %s 1K %s %02d %02d:%02d %s",
+	expected := fmt.Sprintf("total %s\n"+
+		"-rw------- 1 %s %s 1.0K %s %02d %02d:%02d %s",
+		_total(true, path),
 		owner,
 		group,
 		time_now.Month().String()[0:3],
@@ -1113,7 +1323,9 @@ func Test_lh_None_File3(t *testing.T) {
 
 	group := group_map[os.Getgid()]
 
-	expected := fmt.Sprintf("-rw------- 1 %s %s 1.5K %s %02d %02d:%02d %s",
+	expected := fmt.Sprintf("total %s\n"+
+		"-rw------- 1 %s %s 1.5K %s %02d %02d:%02d %s",
+		_total(true, path),
 		owner,
 		group,
 		time_now.Month().String()[0:3],
@@ -1181,6 +1393,35 @@ func Test_S_None_Files2(t *testing.T) {
 	check_error_nil(t, ls_err)
 }
 
+// Test running 'ls -S' and 'ls -rS' in a directory where some files share the
+// same size, which should be ordered by name
+func Test_S_None_FilesSameSize(t *testing.T) {
+	setup_test_dir("S_None_FilesSameSize")
+
+	_mkfile2("d", 0600, os.Getuid(), os.Getgid(), 5, time.Now())
+	_mkfile2("c", 0600, os.Getuid(), os.Getgid(), 2, time.Now())
+	_mkfile2("b", 0600, os.Getuid(), os.Getgid(), 5, time.Now())
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 5, time.Now())
+
+	var output_buffer bytes.Buffer
+	args := []string{"-S"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	check_output(t, output, "a b d c")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-rS"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	check_output(t, output, "c d b a")
+	check_error_nil(t, ls_err)
+}
+
 // Test running 'ls -rS' in a directory with files of the differing sizes.
 func Test_rS_None_Files(t *testing.T) {
 	setup_test_dir("rS_None_Files")
@@ -1201,6 +1442,27 @@ func Test_rS_None_Files(t *testing.T) {
 	check_error_nil(t, ls_err)
 }
 
+// Test running 'ls -hS' in a directory with files whose human-readable sizes
+// have different units
+func Test_hS_None_Files(t *testing.T) {
+	setup_test_dir("hS_None_Files")
+
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 1485, time.Now())
+	_mkfile2("b", 0600, os.Getuid(), os.Getgid(), 900, time.Now())
+	_mkfile2("c", 0600, os.Getuid(), os.Getgid(), 2048, time.Now())
+
+	var output_buffer bytes.Buffer
+	args := []string{"-hS"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	expected := "c a b"
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+}
+
 // Test running 'ls --dirs-first' in an empty directory
 func Test_dirsfirst_None_None(t *testing.T) {
 	setup_test_dir("dirsfirst_None_None")
@@ -1286,146 +1548,1549 @@ func Test_dirsfirst_FilesAndDirs_FilesAndDirs(t *testing.T) {
 	check_error_nil(t, ls_err)
 }
 
-// -------------------------------COLOR TESTS-----------------------------------
-
-// Test LSCOLORS directory color
-func Test_LSCOLORS_Dir(t *testing.T) {
-	setup_test_dir("LSCOLORS_Dir")
-
-	_mkdir("test_dir")
+// Test running 'ls -R' in a directory with nested files and directories
+func Test_R_None_FilesAndDirs(t *testing.T) {
+	setup_test_dir("R_None_FilesAndDirs")
 
-	os.Setenv("LSCOLORS", default_LSCOLORS)
+	_mkfile("a")
+	_mkdir("dir1")
+	_mkfile("dir1/b")
+	_mkdir("dir1/dir2")
+	_mkfile("dir1/dir2/c")
+	_mkdir("dir3")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
+	args := []string{"-R", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
 	output := clean_output_buffer(output_buffer)
 
-	expected := fmt.Sprintf("\x1b[0;34mtest_dir\x1b[0m")
+	expected := ".:\n" +
+		"a dir1 dir3\n\n" +
+		"./dir1:\n" +
+		"b dir2\n\n" +
+		"./dir1/dir2:\n" +
+		"c\n\n" +
+		"./dir3:"
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
 }
 
-// Test LS_COLORS directory color
-func Test_LS_COLORS_Dir(t *testing.T) {
-	setup_test_dir("LS_COLORS_Dir")
-
-	_mkdir("test_dir")
+// Test running 'ls -aR dir1 --dirs-first' with a symlink to a directory, which
+// should not be followed
+func Test_aR_Dir_DirsFirstLink(t *testing.T) {
+	setup_test_dir("aR_Dir_DirsFirstLink")
 
-	os.Setenv("LS_COLORS", default_LS_COLORS)
+	_mkdir("dir1")
+	_mkfile("dir1/a")
+	_mkdir("dir1/dir2")
+	_mkfile("dir1/dir2/.b")
+	_mklink("dir2", "dir1/link")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
+	args := []string{"-aR", "--dirs-first", "--nocolor", "dir1"}
+	ls_err := ls(&output_buffer, args, tw)
+
 	output := clean_output_buffer(output_buffer)
 
-	expected := fmt.Sprintf("\x1b[01;34mtest_dir\x1b[0m")
+	expected := "dir1:\n" +
+		". .. dir2 a link\n\n" +
+		"dir1/dir2:\n" +
+		". .. .b"
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
 }
 
-// Test directory color with neither LSCOLORS or LS_COLORS defined--should
-// default to the LSCOLORS specification
-func Test_blankCOLOR_Dir(t *testing.T) {
-	setup_test_dir("blankCOLOR_Dir")
+// Test running 'ls --json' in a directory with a file and a symlink
+func Test_json_None_FileAndLink(t *testing.T) {
+	setup_test_dir("json_None_FileAndLink")
 
-	_mkdir("test_dir")
+	time_now := time.Now()
+	_mkfile2("a", 0640, os.Getuid(), os.Getgid(), 1485, time_now)
+	_mklink("a", "b")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
-	output := clean_output_buffer(output_buffer)
+	args := []string{"--json", "-h"}
+	ls_err := ls(&output_buffer, args, tw)
 
-	expected := fmt.Sprintf("\x1b[0;34mtest_dir\x1b[0m")
+	var listings []listing.JSONListing
+	err := json.Unmarshal(output_buffer.Bytes(), &listings)
+	if err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, output_buffer.String())
+	}
 
-	check_output(t, output, expected)
-	check_error_nil(t, err)
-}
+	if len(listings) != 2 {
+		t.Fatalf("expected 2 listings, but got %d", len(listings))
+	}
 
-// Test LSCOLORS world-writeable directory color
-func Test_LSCOLORS_ow_Dir(t *testing.T) {
-	setup_test_dir("LSCOLORS_ow_Dir")
+	a := listings[0]
+	check_output(t, a.Name, "a")
+	check_output(t, a.Type, "file")
+	check_output(t, a.Permissions, "-rw-r-----")
+	check_output(t, fmt.Sprintf("%d", a.Size), "1485")
+	check_output(t, fmt.Sprintf("%o", a.Mode), "100640")
+	check_output(t, fmt.Sprintf("%d", a.NumHardLinks), "1")
+	check_output(t, fmt.Sprintf("%d", a.Uid), fmt.Sprintf("%d", os.Getuid()))
+	check_output(t, fmt.Sprintf("%d", a.Gid), fmt.Sprintf("%d", os.Getgid()))
+	check_output(t, fmt.Sprintf("%d", a.EpochNano),
+		fmt.Sprintf("%d", time_now.UnixNano()))
+	check_output(t, a.ModTime,
+		time_now.Format("2006-01-02T15:04:05.999999999-07:00"))
+
+	b := listings[1]
+	check_output(t, b.Name, "b")
+	check_output(t, b.Type, "symlink")
+	check_output(t, b.LinkName, "a")
+	check_output(t, fmt.Sprintf("%v", b.LinkOrphan), "false")
 
-	_mkdir2("test_dir", 0777, os.Getuid(), os.Getuid(), time.Now())
+	check_error_nil(t, ls_err)
+}
 
-	os.Setenv("LSCOLORS", default_LSCOLORS)
+// Test running 'ls --json a dir1 dir2', which should group the listings under
+// their directories
+func Test_json_FilesAndDirs_FilesAndDirs(t *testing.T) {
+	setup_test_dir("json_FilesAndDirs_FilesAndDirs")
+
+	_mkfile("a")
+	_mkdir("dir1")
+	_mkfile("dir1/b")
+	_mkfile("dir1/c")
+	_mkdir("dir2")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
-	output := clean_output_buffer(output_buffer)
+	args := []string{"--json", "a", "dir1", "dir2"}
+	ls_err := ls(&output_buffer, args, tw)
 
-	expected := fmt.Sprintf("\x1b[0;30;43mtest_dir\x1b[0m")
+	var document listing.JSONDocument
+	err := json.Unmarshal(output_buffer.Bytes(), &document)
+	if err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, output_buffer.String())
+	}
+
+	output := ""
+	for _, l := range document.Files {
+		output += l.Name + " "
+	}
+	for _, d := range document.Directories {
+		output += d.Path + ": "
+		for _, l := range d.Entries {
+			output += l.Name + " "
+		}
+	}
+
+	expected := "a dir1: b c dir2: "
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
 }
 
-// Test LS_COLORS world-writeable directory color
-func Test_LS_COLORS_ow_Dir(t *testing.T) {
-	setup_test_dir("LS_COLORS_ow_Dir")
-
-	_mkdir2("test_dir", 0777, os.Getuid(), os.Getuid(), time.Now())
+// Test running 'ls -1r --all' with bundled short options and a long option
+func Test_1r_all_None_Files(t *testing.T) {
+	setup_test_dir("1r_all_None_Files")
 
-	os.Setenv("LS_COLORS", default_LS_COLORS)
+	_mkfile("a")
+	_mkfile(".b")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
+	args := []string{"-1r", "--all", "--nocol"}
+	ls_err := ls(&output_buffer, args, tw)
+
 	output := clean_output_buffer(output_buffer)
 
-	expected := fmt.Sprintf("\x1b[34;42mtest_dir\x1b[0m")
+	expected := "a\n.b\n..\n."
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
 }
 
-// Test LSCOLORS world-writeable, sticky-bit directory color
-func Test_LSCOLORS_ow_sticky_Dir(t *testing.T) {
-	setup_test_dir("LSCOLORS_ow_sticky_Dir")
-
-	_mkdir2("test_dir",
-		0777|os.ModeSticky,
-		os.Getuid(),
-		os.Getuid(),
-		time.Now())
+// Test running 'ls -- -a', which should list the file named '-a'
+func Test_DoubleDash_File_DashFile(t *testing.T) {
+	setup_test_dir("DoubleDash_File_DashFile")
 
-	os.Setenv("LSCOLORS", default_LSCOLORS)
+	_mkfile("-a")
+	_mkfile("b")
 
 	var output_buffer bytes.Buffer
-	args := []string{}
-	err := ls(&output_buffer, args, tw)
+	args := []string{"-1", "--", "-a"}
+	ls_err := ls(&output_buffer, args, tw)
+
 	output := clean_output_buffer(output_buffer)
 
-	expected := fmt.Sprintf("\x1b[0;30;42mtest_dir\x1b[0m")
+	expected := "-a"
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
 }
 
-// Test LS_COLORS world-writeable, sticky-bit directory color
-func Test_LS_COLORS_ow_sticky_Dir(t *testing.T) {
-	setup_test_dir("LS_COLORS_ow_sticky_Dir")
+// Test running ls with unknown or malformed options, which should fail without
+// listing anything
+func Test_InvalidOptions(t *testing.T) {
+	setup_test_dir("InvalidOptions")
 
-	_mkdir2("test_dir",
-		0777|os.ModeSticky,
-		os.Getuid(),
-		os.Getuid(),
-		time.Now())
+	_mkfile("a")
 
-	os.Setenv("LS_COLORS", default_LS_COLORS)
+	invalid_args := map[string]string{
+		"-help":             "invalid option -- 'e'",
+		"--foo":             "unrecognized option '--foo'",
+		"--json=yes":        "option '--json' doesn't allow an argument",
+		"--dirs-first":      "",
+		"--d":               "option '--d' is ambiguous",
+		"--width=x":         "invalid line width: 'x'",
+		"--color=red":       "invalid argument 'red' for '--color'",
+		"--print-colors=x":  "invalid argument 'x' for '--print-colors'",
+		"--time=x":          "invalid argument 'x' for '--time'",
+		"--time-style=x":    "invalid argument 'x' for '--time-style'",
+		"--tz=Nowhere/Foo":  "invalid time zone 'Nowhere/Foo'",
+		"--block-size=x":    "invalid block size 'x'",
+		"--classify=x":      "invalid argument 'x' for '--classify'",
+		"--format=x":        "invalid argument 'x' for '--format'",
+		"--hyperlink=x":     "invalid argument 'x' for '--hyperlink'",
+		"--type=d,x":        "invalid argument 'd,x' for '--type'",
+		"--type=df":         "invalid argument 'df' for '--type'",
+		"--quoting-style=x": "invalid argument 'x' for '--quoting-style'",
+		"--indicator-style=x": "invalid argument 'x' for " +
+			"'--indicator-style'",
+		"-w": "option requires an argument -- 'w'",
+	}
+
+	for arg, expected_err := range invalid_args {
+		var output_buffer bytes.Buffer
+		args := []string{arg}
+		ls_err := ls(&output_buffer, args, tw)
+
+		if expected_err == "" {
+			check_error_nil(t, ls_err)
+			continue
+		}
+
+		check_output(t, output_buffer.String(), "")
+		check_error(t, ls_err, expected_err)
+		if _, ok := ls_err.(UsageError); !ok {
+			t.Logf("error for %s is not a UsageError", arg)
+			t.Fail()
+		}
+	}
+}
+
+// Test running ls when stdout is not a terminal, which should list one entry
+// per line
+func Test_NotTerminal_None_Files(t *testing.T) {
+	setup_test_dir("NotTerminal_None_Files")
+
+	_mkfile("a")
+	_mkfile("b")
+	_mkfile("c")
 
 	var output_buffer bytes.Buffer
 	args := []string{}
-	err := ls(&output_buffer, args, tw)
+	ls_err := ls_to(&output_buffer, args, tw, false, nil)
+
 	output := clean_output_buffer(output_buffer)
 
-	expected := fmt.Sprintf("\x1b[30;42mtest_dir\x1b[0m")
+	expected := "a\nb\nc"
 
 	check_output(t, output, expected)
-	check_error_nil(t, err)
+	check_error_nil(t, ls_err)
+}
+
+// Test running ls with an explicit line width, which should override the
+// terminal's
+func Test_w_None_Files(t *testing.T) {
+	setup_test_dir("w_None_Files")
+
+	_mkfile("a")
+	_mkfile("b")
+	_mkfile("c")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-w", "5"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	expected := "a c\nb"
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+
+	// a width of 0 places no limit on the columns
+	output_buffer.Reset()
+	args = []string{"--width=0"}
+	ls_err = ls(&output_buffer, args, 1)
+
+	output = clean_output_buffer(output_buffer)
+
+	expected = "a b c"
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+}
+
+// Test that the output width falls back to $COLUMNS when stdout is not a
+// terminal
+func Test_output_width_COLUMNS(t *testing.T) {
+	os.Setenv("COLUMNS", "42")
+	defer os.Unsetenv("COLUMNS")
+
+	// the test's stdin is never a terminal with a size
+	fd, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	width, is_terminal := output_width(int(fd.Fd()))
+	if width != 42 || is_terminal {
+		t.Logf("expected width 42 on a non-terminal, got %d (terminal: %v)",
+			width, is_terminal)
+		t.Fail()
+	}
+
+	os.Unsetenv("COLUMNS")
+	width, _ = output_width(int(fd.Fd()))
+	if width != 80 {
+		t.Logf("expected default width 80, got %d", width)
+		t.Fail()
+	}
+}
+
+// Test piping paths to ls, one per line, including a path with spaces
+func Test_Stdin_Files_Spaces(t *testing.T) {
+	setup_test_dir("Stdin_Files_Spaces")
+
+	_mkfile("a b")
+	_mkfile("c")
+	_mkfile("d")
+
+	stdin := _mkstdin(t, "a b\nc\n")
+	defer stdin.Close()
+
+	var output_buffer bytes.Buffer
+	args := []string{"-1"}
+	ls_err := ls_to(&output_buffer, args, tw, true, stdin)
+
+	output := clean_output_buffer(output_buffer)
+
+	// names are quoted for the shell on a terminal
+	expected := "'a b'\nc"
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls -0' with NUL-separated paths piped to it, as from
+// 'find -print0'
+func Test_null_Stdin_Files(t *testing.T) {
+	setup_test_dir("null_Stdin_Files")
+
+	_mkfile("a\nb")
+	_mkfile("c")
+	_mkfile("d")
+
+	stdin := _mkstdin(t, "a\nb\x00d\x00")
+	defer stdin.Close()
+
+	var output_buffer bytes.Buffer
+	args := []string{"-0", "--json"}
+	ls_err := ls_to(&output_buffer, args, tw, true, stdin)
+
+	var listings []listing.JSONListing
+	err := json.Unmarshal(output_buffer.Bytes(), &listings)
+	if err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+
+	names := make([]string, 0)
+	for _, l := range listings {
+		names = append(names, l.Name)
+	}
+
+	check_output(t, strings.Join(names, ","), "a\nb,d")
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls --files-from=FILE', which should list the paths in FILE
+// along with the ones given as arguments
+func Test_files_from_File_Files(t *testing.T) {
+	setup_test_dir("files_from_File_Files")
+
+	_mkfile("a")
+	_mkfile("b")
+	_mkfile("c")
+
+	err := ioutil.WriteFile("list", []byte("a\n\nc\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"-1", "--files-from=list", "list"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	expected := "a\nc\nlist"
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"--files-from", "missing"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "")
+	check_error(t, ls_err,
+		"cannot open 'missing' for reading: no such file or directory")
+}
+
+// return the inode number of the given path
+func _inode(path string) uint64 {
+	info, err := os.Lstat(path)
+	if err != nil {
+		fmt.Printf("error: os.Lstat(%s)\n", path)
+		fmt.Printf("\t%v\n", err)
+		os.Exit(1)
+	}
+
+	return uint64(info.Sys().(*syscall.Stat_t).Ino)
+}
+
+// Test running 'ls -is', which should put the inode number and allocated blocks
+// in front of each name, with a total line for the directory
+func Test_is_None_Files(t *testing.T) {
+	setup_test_dir("is_None_Files")
+
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 5000, time.Now())
+	_mkfile("b")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-is", "-w", "0"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("total %s\n%d %s a %d %s b",
+		_total(false, "a", "b"),
+		_inode("a"), _total(false, "a"),
+		_inode("b"), _total(false, "b"))
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+
+	// files given as arguments have no total line
+	output_buffer.Reset()
+	args = []string{"-1s", "b"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	expected = fmt.Sprintf("%s b", _total(false, "b"))
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls -n', 'ls -g' and 'ls -o', which are long listings with
+// numeric ids, or without the owner or group
+func Test_ngo_File_File(t *testing.T) {
+	setup_test_dir("ngo_File_File")
+
+	time_now := time.Now()
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 13, time_now)
+
+	date := fmt.Sprintf("%s %02d %02d:%02d", time_now.Month().String()[0:3],
+		time_now.Day(), time_now.Hour(), time_now.Minute())
+
+	var owner string
+	owner_lookup, err := user.LookupId(fmt.Sprintf("%d", os.Getuid()))
+	if err != nil {
+		owner = user_map[int(os.Getuid())]
+	} else {
+		owner = owner_lookup.Username
+	}
+
+	group := group_map[os.Getgid()]
+
+	tests := map[string]string{
+		"-n":  fmt.Sprintf("%d %d", os.Getuid(), os.Getgid()),
+		"-g":  group,
+		"-o":  owner,
+		"-go": "",
+	}
+
+	for arg, ids := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{arg, "a"}
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := clean_output_buffer(output_buffer)
+
+		expected := strings.Replace(
+			fmt.Sprintf("-rw------- 1 %s 13 %s a", ids, date), "  ", " ", 1)
+
+		check_output(t, output, expected)
+		check_error_nil(t, ls_err)
+	}
+}
+
+// Test running 'ls -u', 'ls -c' and 'ls --time', which show and sort by the
+// access or status change time instead of the modification time
+func Test_u_None_Files(t *testing.T) {
+	setup_test_dir("u_None_Files")
+
+	time_now := time.Now()
+	time_old := time.Date(2001, time.January, 1, 0, 0, 0, 0, time.Local)
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 13, time_now)
+	_mkfile2("b", 0600, os.Getuid(), os.Getgid(), 13,
+		time_now.Add(-10*time.Second))
+	os.Chtimes("a", time_old, time_now)
+	os.Chtimes("b", time_now.Add(-5*time.Second),
+		time_now.Add(-10*time.Second))
+
+	tests := map[string]string{
+		"-t":           "a b",
+		"-u":           "b a",
+		"--time=atime": "b a",
+		"-ltu":         "b a",
+		"-lu":          "a b",
+		"-ut":          "b a",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{"-w", "0", arg}
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := clean_output_buffer(output_buffer)
+		if strings.Contains(arg, "l") {
+			// just the names from the long listing
+			names := make([]string, 0)
+			for _, line := range strings.Split(output, "\n")[1:] {
+				fields := strings.Fields(line)
+				names = append(names, fields[len(fields)-1])
+			}
+			output = strings.Join(names, " ")
+		}
+
+		if output != expected {
+			t.Logf("ls %s: expected \"%s\", but got \"%s\"", arg, expected,
+				output)
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	// the long format shows the chosen time
+	var output_buffer bytes.Buffer
+	args := []string{"-ou", "a"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("-rw------- 1 %s 13 Jan 01 2001 a",
+		strings.Fields(output)[2])
+
+	check_output(t, output, expected)
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-oc", "a"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	if strings.Contains(output, "2001") {
+		t.Logf("ls -oc shows the access time: \"%s\"", output)
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls --full-time' and 'ls --time-style', along with the
+// TIME_STYLE environment variable
+func Test_time_style_File(t *testing.T) {
+	setup_test_dir("time_style_File")
+
+	mod_time := time.Date(2021, time.November, 30, 8, 4, 5, 123456789,
+		time.Local)
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 13, mod_time)
+
+	full_iso := mod_time.Format("2006-01-02 15:04:05.000000000 -0700")
+
+	tests := map[string]string{
+		"--full-time":            full_iso,
+		"--time-style=long-iso":  "2021-11-30 08:04",
+		"--time-style=posix-iso": "2021-11-30",
+		"--time-style=+%d/%m %T": "30/11 08:04:05",
+		"--time-style=locale":    "Nov 30 2021",
+	}
+
+	for arg, timestamp := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{"-o", arg, "a"}
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := clean_output_buffer(output_buffer)
+
+		expected := fmt.Sprintf("-rw------- 1 %s 13 %s a",
+			strings.Fields(output)[2], timestamp)
+
+		check_output(t, output, expected)
+		check_error_nil(t, ls_err)
+	}
+
+	os.Setenv("TIME_STYLE", "long-iso")
+	defer os.Unsetenv("TIME_STYLE")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-o", "a"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	if !strings.Contains(output, " 2021-11-30 08:04 a") {
+		t.Logf("TIME_STYLE wasn't used: \"%s\"", output)
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+
+	// --time-style takes precedence
+	output_buffer.Reset()
+	args = []string{"-o", "--time-style=iso", "a"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	output = clean_output_buffer(output_buffer)
+
+	if !strings.Contains(output, " 2021-11-30 a") {
+		t.Logf("--time-style wasn't used: \"%s\"", output)
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+
+	os.Setenv("TIME_STYLE", "bogus")
+	output_buffer.Reset()
+	ls_err = ls(&output_buffer, []string{"-l", "a"}, tw)
+	check_error(t, ls_err, "invalid TIME_STYLE 'bogus'")
+}
+
+// Test running 'ls --tz', which changes the time zone of the long format and
+// --json, and setting the TZ environment variable, which is warned about if it
+// can't be loaded
+func Test_tz_File(t *testing.T) {
+	setup_test_dir("tz_File")
+
+	mod_time := time.Date(2021, time.November, 30, 8, 4, 5, 0, time.UTC)
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 13, mod_time)
+
+	tests := []struct {
+		tz       string
+		args     []string
+		expected string
+	}{
+		{"", []string{"--tz=UTC", "--full-time"},
+			"2021-11-30 08:04:05.000000000 +0000"},
+		{"", []string{"--tz=Asia/Tokyo", "--full-time"},
+			"2021-11-30 17:04:05.000000000 +0900"},
+		{":Asia/Tokyo", []string{"--tz", "America/New_York", "--full-time"},
+			"2021-11-30 03:04:05.000000000 -0500"},
+		{"", []string{"--tz=UTC", "--json"}, "\"2021-11-30T08:04:05+00:00\""},
+		{"", []string{"--tz=Asia/Tokyo", "--json"},
+			"\"2021-11-30T17:04:05+09:00\""},
+	}
+
+	for _, test := range tests {
+		if test.tz != "" {
+			os.Setenv("TZ", test.tz)
+		} else {
+			os.Unsetenv("TZ")
+		}
+
+		var output_buffer bytes.Buffer
+		args := append(test.args, "a")
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := clean_output_buffer(output_buffer)
+		if !strings.Contains(output, test.expected) {
+			t.Logf("TZ=%s ls %v: expected \"%s\" in \"%s\"", test.tz, args,
+				test.expected, output)
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	// zone names and zone files are loaded into time.Local when the program
+	// starts, while anything else, including POSIX rules, is taken to be UTC
+	valid := []string{"", "UTC", "Asia/Tokyo", ":Asia/Tokyo"}
+	if _, err := os.Stat("/usr/share/zoneinfo/Asia/Tokyo"); err == nil {
+		valid = append(valid, "/usr/share/zoneinfo/Asia/Tokyo",
+			":/usr/share/zoneinfo/Asia/Tokyo")
+	}
+	for _, tz := range valid {
+		os.Setenv("TZ", tz)
+
+		var output_buffer bytes.Buffer
+		args := []string{"-l", "a"}
+		ls_err := ls(&output_buffer, args, tw)
+
+		if ls_err != nil {
+			t.Logf("TZ=%s ls %v: unexpected error %v", tz, args, ls_err)
+			t.Fail()
+		}
+	}
+
+	for _, tz := range []string{"Nowhere/Foo", "JST-9", "/nowhere"} {
+		os.Setenv("TZ", tz)
+
+		var output_buffer bytes.Buffer
+		args := []string{"-l", "a"}
+		ls_err := ls(&output_buffer, args, tw)
+
+		check_error(t, ls_err, fmt.Sprintf("unknown time zone in "+
+			"environment variable TZ, using UTC: '%s'", tz))
+		check_exit_status(t, ls_err, 0)
+	}
+	os.Unsetenv("TZ")
+}
+
+// Test running 'ls --si', 'ls --block-size' and 'ls -k', and setting the
+// LS_BLOCK_SIZE and BLOCK_SIZE environment variables
+func Test_block_size_File(t *testing.T) {
+	setup_test_dir("block_size_File")
+
+	_mkfile2("a", 0600, os.Getuid(), os.Getgid(), 1234567, time.Now())
+
+	blocks := _total(false, "a")
+	info, _ := os.Lstat("a")
+	block_bytes := fmt.Sprintf("%d", info.Sys().(*syscall.Stat_t).Blocks*512)
+
+	tests := []struct {
+		variable string
+		value    string
+		args     []string
+		expected string
+	}{
+		{"", "", []string{"-l"}, "1234567"},
+		{"", "", []string{"-l", "--si"}, "1.3M"},
+		{"", "", []string{"-l", "--block-size=K"}, "1206K"},
+		{"", "", []string{"-l", "--block-size=1K"}, "1206"},
+		{"", "", []string{"-l", "--block-size=MB"}, "2MB"},
+		{"", "", []string{"-l", "--block-size='1"}, "1,234,567"},
+		{"", "", []string{"-l", "--block-size=K", "-h"}, "1.2M"},
+		{"", "", []string{"-l", "-h", "--block-size=K"}, "1206K"},
+		{"", "", []string{"-s", "--block-size=1"}, block_bytes},
+		{"", "", []string{"-sk"}, blocks},
+		{"LS_BLOCK_SIZE", "K", []string{"-l"}, "1206K"},
+		{"LS_BLOCK_SIZE", "K", []string{"-l", "--block-size=1"}, "1234567"},
+		{"LS_BLOCK_SIZE", "bogus", []string{"-l"}, "1234567"},
+		{"BLOCK_SIZE", "1K", []string{"-l"}, "1206"},
+		{"BLOCK_SIZE", "1", []string{"-s"}, block_bytes},
+		{"BLOCK_SIZE", "1", []string{"-sk"}, blocks},
+	}
+
+	for _, test := range tests {
+		if test.variable != "" {
+			os.Setenv(test.variable, test.value)
+		}
+
+		var output_buffer bytes.Buffer
+		args := append(test.args, "a")
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := " " + clean_output_buffer(output_buffer) + " "
+		if !strings.Contains(output, " "+test.expected+" ") {
+			t.Logf("%s=%s ls %v: expected \"%s\" in \"%s\"", test.variable,
+				test.value, args, test.expected, output)
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+
+		if test.variable != "" {
+			os.Unsetenv(test.variable)
+		}
+	}
+}
+
+// Test running 'ls -F', 'ls -p', 'ls --file-type' and 'ls --indicator-style',
+// which mark the type of each entry after its name
+func Test_F_Files(t *testing.T) {
+	setup_test_dir("F_Files")
+
+	_mkdir("d")
+	_mkfile2("e", 0700, os.Getuid(), os.Getgid(), 0, time.Now())
+	_mkfile("f")
+	_mklink("f", "l")
+	_mkfifo("p")
+
+	tests := map[string]string{
+		"-F":                          "d/ e* f l@ p|",
+		"--classify":                  "d/ e* f l@ p|",
+		"-p":                          "d/ e f l p",
+		"--file-type":                 "d/ e f l@ p|",
+		"--indicator-style=slash":     "d/ e f l p",
+		"--indicator-style=file-type": "d/ e f l@ p|",
+		"--indicator-style=classify":  "d/ e* f l@ p|",
+		"--indicator-style=none":      "d e f l p",
+		"--classify=never":            "d e f l p",
+		"-pF":                         "d/ e* f l@ p|",
+		"-Fp":                         "d/ e f l p",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{"-w", "0", "--nocolor", arg}
+		ls_err := ls(&output_buffer, args, tw)
+
+		output := clean_output_buffer(output_buffer)
+
+		if output != expected {
+			t.Logf("ls %s: expected \"%s\", but got \"%s\"", arg, expected,
+				output)
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	// symlinks are followed by their targets in the long format instead
+	var output_buffer bytes.Buffer
+	args := []string{"-lF", "--nocolor", "l"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := clean_output_buffer(output_buffer)
+
+	if !strings.HasSuffix(output, " l -> f") {
+		t.Logf("unexpected 'ls -lF l' output: \"%s\"", output)
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+
+	// --classify=auto only applies to terminals, unlike -F
+	output_buffer.Reset()
+	args = []string{"--classify=auto", "d", "e"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, clean_output_buffer(output_buffer), "e\n\nd:")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-F", "e"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, clean_output_buffer(output_buffer), "e*")
+	check_error_nil(t, ls_err)
+}
+
+// Test that the indicators are counted in the widths of the columns
+func Test_F_Columns(t *testing.T) {
+	setup_test_dir("F_Columns")
+
+	_mkdir("aa")
+	_mkdir("bb")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-w", "7", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "aa  bb")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-w", "7", "-p", "--nocolor"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "aa/\nbb/")
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls -x', which fills each row before the next
+func Test_x_None_Files(t *testing.T) {
+	setup_test_dir("x_None_Files")
+
+	for _, name := range []string{"a", "bb", "ccc", "dddd", "e", "f", "g"} {
+		_mkfile(name)
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"-x", "-w", "20"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	expected := "a  bb  ccc  dddd\ne  f   g"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	// the columns are kept even when the output isn't a terminal
+	output_buffer.Reset()
+	args = []string{"--format=horizontal", "-w", "20"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls -C', which lists entries in columns even when the output
+// isn't a terminal
+func Test_C_None_Files(t *testing.T) {
+	setup_test_dir("C_None_Files")
+
+	for _, name := range []string{"a", "bb", "ccc", "dddd", "e", "f", "g"} {
+		_mkfile(name)
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"-C", "-w", "20"}
+	ls_err := ls_to(&output_buffer, args, tw, false, nil)
+
+	expected := "a   ccc   e  g\nbb  dddd  f"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	// the last layout option wins, except that -1 doesn't replace -l
+	tests := map[string]string{
+		"-1C":                    expected,
+		"-C1":                    "a\nbb\nccc\ndddd\ne\nf\ng",
+		"--format=vertical":      expected,
+		"--format=single-column": "a\nbb\nccc\ndddd\ne\nf\ng",
+		"-xC":                    expected,
+		"-lC":                    expected,
+		"-mC":                    expected,
+	}
+
+	for arg, expected := range tests {
+		output_buffer.Reset()
+		args = []string{"-w", "20", arg}
+		ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+		if output_buffer.String() != expected {
+			t.Logf("ls %s: expected \"%s\", but got \"%s\"", arg, expected,
+				output_buffer.String())
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	output_buffer.Reset()
+	args = []string{"-l1", "--nocolor", "a"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	if !strings.HasPrefix(output_buffer.String(), "-rw") {
+		t.Logf("'ls -l1' should give a long listing, but got \"%s\"",
+			output_buffer.String())
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls -m', which separates entries with commas and wraps them at
+// the line width
+func Test_m_None_Files(t *testing.T) {
+	setup_test_dir("m_None_Files")
+
+	for _, name := range []string{"a", "bb", "ccc", "dddd", "e", "f", "g"} {
+		_mkfile(name)
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"-m", "-w", "20"}
+	ls_err := ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, output_buffer.String(), "a, bb, ccc, dddd, e,\nf, g")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"--format=commas", "-w", "0"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "a, bb, ccc, dddd, e, f, g")
+	check_error_nil(t, ls_err)
+}
+
+// Test that names with wide characters and combining marks are lined up by
+// the columns they take, rather than their length in bytes
+func Test_None_None_WideFiles(t *testing.T) {
+	setup_test_dir("None_None_WideFiles")
+
+	_mkfile("a")
+	_mkfile("b")
+	_mkfile("cafe\u0301")
+	_mkfile("\u65e5\u672c")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-w", "14", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	expected := "a  cafe\u0301\nb  \u65e5\u672c"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-x", "-w", "15", "--nocolor"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	expected = "a     b\ncafe\u0301  \u65e5\u672c"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-m", "-w", "17", "--nocolor"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	expected = "a, b, cafe\u0301, \u65e5\u672c"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+}
+
+// Test the quoting styles, and that control characters in names are only
+// written as they are when the output isn't a terminal
+func Test_quoting_style_Files(t *testing.T) {
+	setup_test_dir("quoting_style_Files")
+
+	_mkfile("\x1b[31mred")
+	_mkfile("a b")
+	_mkfile("a\nb")
+	_mkfile("it's")
+	_mkfile("plain")
+
+	tests := map[string]string{
+		"": "$'\\033''[31mred'\n'a'$'\\n''b'\n'a b'\n" +
+			"\"it's\"\nplain",
+		"--quoting-style=shell": "'?[31mred'\n'a?b'\n'a b'\n\"it's\"\nplain",
+		"--quoting-style=shell-always": "'?[31mred'\n'a?b'\n'a b'\n" +
+			"\"it's\"\n'plain'",
+		"--quoting-style=c": "\"\\033[31mred\"\n\"a\\nb\"\n\"a b\"\n" +
+			"\"it's\"\n\"plain\"",
+		"--quoting-style=locale": "\u2018\\033[31mred\u2019\n" +
+			"\u2018a\\nb\u2019\n\u2018a b\u2019\n\u2018it's\u2019\n" +
+			"\u2018plain\u2019",
+		"-b":                      "\\033[31mred\na\\nb\na\\ b\nit's\nplain",
+		"--escape":                "\\033[31mred\na\\nb\na\\ b\nit's\nplain",
+		"-N":                      "?[31mred\na?b\na b\nit's\nplain",
+		"--literal":               "?[31mred\na?b\na b\nit's\nplain",
+		"-N --show-control-chars": "\x1b[31mred\na\nb\na b\nit's\nplain",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := append([]string{"-1", "--nocolor"}, strings.Fields(arg)...)
+		ls_err := ls(&output_buffer, args, tw)
+
+		if output_buffer.String() != expected {
+			t.Logf("ls %s: expected %q, but got %q", arg, expected,
+				output_buffer.String())
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	// names are written as they are when the output isn't a terminal, unless
+	// an option or QUOTING_STYLE says otherwise
+	tests = map[string]string{
+		"":   "\x1b[31mred\na\nb\na b\nit's\nplain",
+		"-q": "?[31mred\na?b\na b\nit's\nplain",
+		"--quoting-style=shell-escape": "$'\\033''[31mred'\n'a'$'\\n''b'\n" +
+			"'a b'\n\"it's\"\nplain",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := append([]string{"-1"}, strings.Fields(arg)...)
+		ls_err := ls_to(&output_buffer, args, tw, false, nil)
+
+		if output_buffer.String() != expected {
+			t.Logf("ls %s: expected %q, but got %q", arg, expected,
+				output_buffer.String())
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	os.Setenv("QUOTING_STYLE", "c")
+	defer os.Unsetenv("QUOTING_STYLE")
+
+	var output_buffer bytes.Buffer
+	args := []string{"plain"}
+	ls_err := ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, output_buffer.String(), "\"plain\"")
+	check_error_nil(t, ls_err)
+
+	// options take precedence
+	output_buffer.Reset()
+	args = []string{"-N", "plain"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, output_buffer.String(), "plain")
+	check_error_nil(t, ls_err)
+
+	// an invalid QUOTING_STYLE is ignored with a warning
+	os.Setenv("QUOTING_STYLE", "x")
+
+	output_buffer.Reset()
+	args = []string{"a b"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "'a b'")
+	check_error(t, ls_err,
+		"ignoring invalid value of environment variable QUOTING_STYLE: 'x'")
+	check_exit_status(t, ls_err, 0)
+}
+
+// Test that the paths in errors are quoted like names, so that they can't send
+// escape sequences to the terminal either
+func Test_quoting_style_Errors(t *testing.T) {
+	setup_test_dir("quoting_style_Errors")
+
+	_mkdir("\x1b[31mred")
+	_modify_path("\x1b[31mred", 0000, os.Getuid(), os.Getgid(), time.Now())
+
+	var output_buffer bytes.Buffer
+	args := []string{"-R", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	// reset the permissions so the directory can be deleted
+	_modify_path("\x1b[31mred", 0755, os.Getuid(), os.Getgid(), time.Now())
+
+	check_error(t, ls_err,
+		"open './'$'\\033''[31mred': permission denied")
+	check_exit_status(t, ls_err, 1)
+
+	output_buffer.Reset()
+	args = []string{"-q", "missing\x1b[31m"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_error(t, ls_err,
+		"cannot access missing?[31m: no such file or directory")
+	check_exit_status(t, ls_err, 2)
+}
+
+// Test that quoted names are lined up by their quoted widths, and that link
+// targets are quoted too
+func Test_quoting_style_Columns(t *testing.T) {
+	setup_test_dir("quoting_style_Columns")
+
+	_mkfile("a b")
+	_mkfile("c")
+	_mkfile("d")
+	_mklink("a b", "l")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-x", "-w", "12", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "'a b'  c\nd      l")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-l", "--nocolor", "l"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	if !strings.HasSuffix(output_buffer.String(), " l -> 'a b'") {
+		t.Logf("link target isn't quoted: \"%s\"", output_buffer.String())
+		t.Fail()
+	}
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls --hyperlink', which links each name to its file with an
+// OSC 8 escape sequence that doesn't change the layout
+func Test_hyperlink_Files(t *testing.T) {
+	setup_test_dir("hyperlink_Files")
+
+	_mkfile("a b")
+	_mkfile("c")
+	_mkfile("d")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd(): %v", err)
+	}
+	hostname, _ := os.Hostname()
+	link := func(path string, name string) string {
+		url := "file://" + strings.Replace(hostname, " ", "%20", -1) + path
+		return "\x1b]8;;" + url + "\x1b\\" + name + "\x1b]8;;\x1b\\"
+	}
+
+	var output_buffer bytes.Buffer
+	args := []string{"--hyperlink", "-N", "-x", "-w", "8", "--nocolor"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	expected := link(cwd+"/a%20b", "a b") + "  " + link(cwd+"/c", "c") +
+		"\n" + link(cwd+"/d", "d")
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	// directory headers are linked too
+	output_buffer.Reset()
+	args = []string{"--hyperlink=always", "-N", "--nocolor", ".", "c"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	expected = link(cwd+"/c", "c") + "\n\n" + link(cwd, ".") + ":\n" +
+		link(cwd+"/a%20b", "a b") + "  " + link(cwd+"/c", "c") + "  " +
+		link(cwd+"/d", "d")
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, ls_err)
+
+	// --hyperlink=auto only links names on a terminal
+	output_buffer.Reset()
+	args = []string{"--hyperlink=auto", "c"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+
+	check_output(t, output_buffer.String(), "c")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"--hyperlink=auto", "--nocolor", "c"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), link(cwd+"/c", "c"))
+	check_error_nil(t, ls_err)
+}
+
+// Test running 'ls --type', '--only-dirs' and '--only-files', which only list
+// the entries of the given types, both in directories and in the arguments
+func Test_type_FilesAndDirs(t *testing.T) {
+	setup_test_dir("type_FilesAndDirs")
+
+	_mkdir("dir")
+	_mkdir("dir/sub")
+	_mkfile("dir/b")
+	_mkfile("dir/sub/c")
+	_mkfile("a")
+	_mklink("a", "l")
+	_mkfifo("p")
+
+	tests := map[string]string{
+		"--type=d":     "dir",
+		"--only-dirs":  "dir",
+		"--type=f":     "a",
+		"--only-files": "a",
+		"--type=l,p":   "l\np",
+		"--type=f,d,l": "a\ndir\nl",
+	}
+
+	for arg, expected := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{"-1", "--nocolor", arg}
+		ls_err := ls(&output_buffer, args, tw)
+
+		if output_buffer.String() != expected {
+			t.Logf("ls %s: expected %q, but got %q", arg, expected,
+				output_buffer.String())
+			t.Fail()
+		}
+		check_error_nil(t, ls_err)
+	}
+
+	// the files given as arguments are filtered too, while directories are
+	// still listed
+	var output_buffer bytes.Buffer
+	args := []string{"-1", "--nocolor", "--only-dirs", "a", "l", "dir"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "dir:\nsub")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"-1d", "--nocolor", "--only-dirs", "a", "l", "dir"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "dir")
+	check_error_nil(t, ls_err)
+
+	// -R still descends into the directories that aren't listed
+	output_buffer.Reset()
+	args = []string{"-1R", "--nocolor", "--only-files", "dir"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "dir:\nb\n\ndir/sub:\nc")
+	check_error_nil(t, ls_err)
+}
+
+// Test that 'ls --help' lists every option in the option table
+func Test_help(t *testing.T) {
+	setup_test_dir("help")
+
+	var output_buffer bytes.Buffer
+	args := []string{"--help"}
+	ls_err := ls(&output_buffer, args, tw)
+
+	output := output_buffer.String()
+
+	if !strings.HasPrefix(output, "usage:  ls [OPTIONS] [FILES]\n") {
+		t.Logf("unexpected --help output:\n%s", output)
+		t.Fail()
+	}
+
+	for _, line := range []string{
+		"    --dirs-first",
+		"    -a, --all",
+		"    -1 ",
+		"list subdirectories recursively",
+	} {
+		if !strings.Contains(output, line) {
+			t.Logf("--help output is missing \"%s\"", line)
+			t.Fail()
+		}
+	}
+
+	check_error_nil(t, ls_err)
+}
+
+// -------------------------------COLOR TESTS-----------------------------------
+
+// Test LSCOLORS directory color
+func Test_LSCOLORS_Dir(t *testing.T) {
+	setup_test_dir("LSCOLORS_Dir")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[0;34mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test that color is only used when stdout is not a terminal if --color is
+// given
+func Test_LSCOLORS_NotTerminal_Dir(t *testing.T) {
+	setup_test_dir("LSCOLORS_NotTerminal_Dir")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls_to(&output_buffer, args, tw, false, nil)
+	output := clean_output_buffer(output_buffer)
+
+	expected := "test_dir"
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+
+	output_buffer.Reset()
+	args = []string{"--color"}
+	err = ls_to(&output_buffer, args, tw, false, nil)
+	output = clean_output_buffer(output_buffer)
+
+	expected = "\x1b[0;34mtest_dir\x1b[0m"
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test each --color setting, on a terminal and when piped
+func Test_color_When_Dir(t *testing.T) {
+	setup_test_dir("color_When_Dir")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	colored := "\x1b[0;34mtest_dir\x1b[0m"
+	plain := "test_dir"
+
+	tests := []struct {
+		arg         string
+		is_terminal bool
+		expected    string
+	}{
+		{"--color=always", true, colored},
+		{"--color=always", false, colored},
+		{"--color=yes", false, colored},
+		{"--color=auto", true, colored},
+		{"--color=auto", false, plain},
+		{"--color=never", true, plain},
+		{"--color=none", true, plain},
+	}
+
+	for _, test := range tests {
+		var output_buffer bytes.Buffer
+		args := []string{test.arg}
+		err := ls_to(&output_buffer, args, tw, test.is_terminal, nil)
+		output := clean_output_buffer(output_buffer)
+
+		check_output(t, output, test.expected)
+		check_error_nil(t, err)
+	}
+}
+
+// Test the NO_COLOR, CLICOLOR and CLICOLOR_FORCE environment variables, which
+// only apply to --color=auto
+func Test_NO_COLOR_CLICOLOR_Dir(t *testing.T) {
+	setup_test_dir("NO_COLOR_CLICOLOR_Dir")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	colored := "\x1b[0;34mtest_dir\x1b[0m"
+	plain := "test_dir"
+
+	tests := []struct {
+		variable    string
+		value       string
+		args        []string
+		is_terminal bool
+		expected    string
+	}{
+		{"NO_COLOR", "1", []string{}, true, plain},
+		{"NO_COLOR", "1", []string{"--color=always"}, true, colored},
+		{"CLICOLOR", "0", []string{}, true, plain},
+		{"CLICOLOR_FORCE", "1", []string{}, false, colored},
+		{"CLICOLOR_FORCE", "0", []string{}, false, plain},
+		{"CLICOLOR_FORCE", "1", []string{"--color=never"}, false, plain},
+	}
+
+	for _, test := range tests {
+		os.Setenv(test.variable, test.value)
+
+		var output_buffer bytes.Buffer
+		err := ls_to(&output_buffer, test.args, tw, test.is_terminal,
+			nil)
+		output := clean_output_buffer(output_buffer)
+
+		check_output(t, output, test.expected)
+		check_error_nil(t, err)
+
+		os.Unsetenv(test.variable)
+	}
+}
+
+// Test LS_COLORS directory color
+func Test_LS_COLORS_Dir(t *testing.T) {
+	setup_test_dir("LS_COLORS_Dir")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LS_COLORS", default_LS_COLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[01;34mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test directory color with neither LSCOLORS or LS_COLORS defined--should
+// default to the LSCOLORS specification
+func Test_blankCOLOR_Dir(t *testing.T) {
+	setup_test_dir("blankCOLOR_Dir")
+
+	_mkdir("test_dir")
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[0;34mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test LSCOLORS world-writeable directory color
+func Test_LSCOLORS_ow_Dir(t *testing.T) {
+	setup_test_dir("LSCOLORS_ow_Dir")
+
+	_mkdir2("test_dir", 0777, os.Getuid(), os.Getuid(), time.Now())
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[0;30;43mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test LS_COLORS world-writeable directory color
+func Test_LS_COLORS_ow_Dir(t *testing.T) {
+	setup_test_dir("LS_COLORS_ow_Dir")
+
+	_mkdir2("test_dir", 0777, os.Getuid(), os.Getuid(), time.Now())
+
+	os.Setenv("LS_COLORS", default_LS_COLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[34;42mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test LSCOLORS world-writeable, sticky-bit directory color
+func Test_LSCOLORS_ow_sticky_Dir(t *testing.T) {
+	setup_test_dir("LSCOLORS_ow_sticky_Dir")
+
+	_mkdir2("test_dir",
+		0777|os.ModeSticky,
+		os.Getuid(),
+		os.Getuid(),
+		time.Now())
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[0;30;42mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test LS_COLORS world-writeable, sticky-bit directory color
+func Test_LS_COLORS_ow_sticky_Dir(t *testing.T) {
+	setup_test_dir("LS_COLORS_ow_sticky_Dir")
+
+	_mkdir2("test_dir",
+		0777|os.ModeSticky,
+		os.Getuid(),
+		os.Getuid(),
+		time.Now())
+
+	os.Setenv("LS_COLORS", default_LS_COLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := fmt.Sprintf("\x1b[30;42mtest_dir\x1b[0m")
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
 }
 
 // Test LSCOLORS symlink color
@@ -1468,6 +3133,30 @@ func Test_LS_COLORS_symlink(t *testing.T) {
 	check_error_nil(t, err)
 }
 
+// Test LS_COLORS with "ln=target", which colors symlinks like their targets
+func Test_LS_COLORS_symlink_target(t *testing.T) {
+	setup_test_dir("LS_COLORS_symlink_target")
+
+	_mkdir("d")
+	_mkfile("f.tar")
+	_mklink("d", "ld")
+	_mklink("f.tar", "lf")
+	_mklink("missing", "lo")
+
+	os.Setenv("LS_COLORS", "ln=target:di=01;34:*.tar=01;31:or=40;31;01")
+
+	var output_buffer bytes.Buffer
+	args := []string{"-1"}
+	err := ls(&output_buffer, args, tw)
+
+	expected := "\x1b[01;34md\x1b[0m\n\x1b[01;31mf.tar\x1b[0m\n" +
+		"\x1b[01;34mld\x1b[0m\n\x1b[01;31mlf\x1b[0m\n" +
+		"\x1b[40;31;01mlo\x1b[0m"
+
+	check_output(t, output_buffer.String(), expected)
+	check_error_nil(t, err)
+}
+
 // Test LSCOLORS executable color
 func Test_LSCOLORS_executable(t *testing.T) {
 	setup_test_dir("LSCOLORS_executable")
@@ -1523,8 +3212,15 @@ func Test_LS_COLORS_orphan_link(t *testing.T) {
 	ls_err := ls(&output_buffer, args, tw)
 
 	output := clean_output_buffer(output_buffer)
+	output_lines := strings.SplitN(output, "\n", 2)
+	if len(output_lines) != 2 {
+		t.Fatalf("expected a total line and a listing, got %q", output)
+	}
+	check_output(t, output_lines[0], "total "+_total(false, "b"))
+
 	// remove the permissions string from the output
-	output_noperms := strings.Join(strings.Split(output, " ")[1:], " ")
+	output_noperms := strings.Join(strings.Split(output_lines[1], " ")[1:],
+		" ")
 
 	var owner string
 	owner_lookup, err := user.LookupId(fmt.Sprintf("%d", os.Getuid()))
@@ -1582,4 +3278,176 @@ func Test_LS_COLORS_directory_sticky(t *testing.T) {
 	check_error_nil(t, err)
 }
 
+// Test LS_COLORS with a block device, whose permissions have no directory bits
+// to check
+func Test_LS_COLORS_block_device(t *testing.T) {
+	setup_test_dir("LS_COLORS_block_device")
+
+	devices, err := ioutil.ReadDir("/dev")
+	if err != nil {
+		t.Skipf("/dev can't be read: %v", err)
+	}
+	device := ""
+	for _, info := range devices {
+		if info.Mode()&os.ModeDevice != 0 &&
+			info.Mode()&os.ModeCharDevice == 0 {
+			device = "/dev/" + info.Name()
+			break
+		}
+	}
+	if device == "" {
+		t.Skip("there are no block devices in /dev")
+	}
+
+	os.Setenv("LS_COLORS", default_LS_COLORS)
+
+	var output_buffer bytes.Buffer
+	args := []string{device}
+	ls_err := ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(),
+		"\x1b[40;33;01m"+device+"\x1b[0m")
+	check_error_nil(t, ls_err)
+}
+
+// Test LS_COLORS rules for multi-dot extensions, which should use the longest
+// matching suffix
+func Test_LS_COLORS_multi_extension(t *testing.T) {
+	setup_test_dir("LS_COLORS_multi_extension")
+
+	_mkfile("a.tar")
+	_mkfile("b.TAR.GZ")
+
+	os.Setenv("LS_COLORS", default_LS_COLORS+"*.tar.gz=01;33:")
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := "\x1b[01;31ma.tar\x1b[0m \x1b[01;33mb.TAR.GZ\x1b[0m"
+
+	check_output(t, output, expected)
+	check_error_nil(t, err)
+}
+
+// Test a malformed LS_COLORS entry, which should be reported without stopping
+// the rest of the colors from being used
+func Test_LS_COLORS_malformed(t *testing.T) {
+	setup_test_dir("LS_COLORS_malformed")
+
+	_mkdir("test_dir")
+
+	os.Setenv("LS_COLORS", "di=01;34:bogus")
+
+	var output_buffer bytes.Buffer
+	args := []string{}
+	err := ls(&output_buffer, args, tw)
+	output := clean_output_buffer(output_buffer)
+
+	expected := "\x1b[01;34mtest_dir\x1b[0m"
+
+	check_output(t, output, expected)
+	check_error(t, err, "malformed LS_COLORS entry 'bogus'")
+	check_exit_status(t, err, 0)
+}
+
+// Test reading the colors from a dircolors database, which should take the
+// place of LS_COLORS and LSCOLORS
+func Test_dircolors_Dir(t *testing.T) {
+	setup_test_dir("dircolors_Dir")
+
+	_mkdir("test_dir")
+
+	err := ioutil.WriteFile(".dircolors",
+		[]byte("COLOR all\nDIR 01;33\nbogus 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("LSCOLORS", default_LSCOLORS)
+
+	// COLOR all turns on color even when not writing to a terminal
+	var output_buffer bytes.Buffer
+	args := []string{"--dircolors=.dircolors"}
+	ls_err := ls_to(&output_buffer, args, tw, false, nil)
+	output := clean_output_buffer(output_buffer)
+
+	expected := "\x1b[01;33mtest_dir\x1b[0m"
+
+	check_output(t, output, expected)
+	check_error(t, ls_err, ".dircolors:3: unrecognized keyword 'bogus'")
+	check_exit_status(t, ls_err, 0)
+
+	// but --color still has the final say
+	output_buffer.Reset()
+	args = []string{"--dircolors=.dircolors", "--color=never"}
+	ls_err = ls_to(&output_buffer, args, tw, false, nil)
+	output = clean_output_buffer(output_buffer)
+
+	check_output(t, output, "test_dir")
+
+	// a database with no colors for the terminal turns color off, rather than
+	// falling back on the default colors
+	err = ioutil.WriteFile(".dircolors", []byte("TERM xterm\nDIR 01;33\n"),
+		0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TERM", "dumb")
+	defer os.Unsetenv("TERM")
+
+	output_buffer.Reset()
+	args = []string{"--dircolors=.dircolors", "--color=always"}
+	ls_err = ls(&output_buffer, args, tw)
+	output = clean_output_buffer(output_buffer)
+
+	check_output(t, output, "test_dir")
+	check_error_nil(t, ls_err)
+
+	output_buffer.Reset()
+	args = []string{"--dircolors=.dircolors", "--print-colors"}
+	ls_err = ls(&output_buffer, args, tw)
+
+	check_output(t, output_buffer.String(), "LS_COLORS='';\nexport LS_COLORS")
+	check_error_nil(t, ls_err)
+}
+
+// Test printing the current colors with --print-colors, converting between
+// LSCOLORS and LS_COLORS as needed
+func Test_print_colors(t *testing.T) {
+	setup_test_dir("print_colors")
+
+	tests := []struct {
+		variable string
+		value    string
+		format   string
+		expected string
+	}{
+		{"LS_COLORS", "di=01;34:*.tar=31", "gnu",
+			"LS_COLORS='di=01;34:*.tar=31';\nexport LS_COLORS"},
+		{"LS_COLORS", "di=01;34:*.tar=31", "bsd",
+			"LSCOLORS='Exxxxxxxxxxxxxxxxxxxxx';\nexport LSCOLORS"},
+		{"LSCOLORS", "Exfxcxdxbxegedabagacad", "gnu",
+			"LS_COLORS='di=01;34:ln=35:so=32:pi=33:ex=31:bd=34;46:" +
+				"cd=34;43:su=30;41:sg=30;46:tw=30;42:ow=30;43:';\n" +
+				"export LS_COLORS"},
+		{"LSCOLORS", "", "bsd",
+			"LSCOLORS='exfxcxdxbxegedabagacad';\nexport LSCOLORS"},
+	}
+
+	for _, test := range tests {
+		os.Setenv(test.variable, test.value)
+
+		var output_buffer bytes.Buffer
+		args := []string{"--print-colors=" + test.format}
+		ls_err := ls(&output_buffer, args, tw)
+
+		check_output(t, output_buffer.String(), test.expected)
+		check_error_nil(t, ls_err)
+
+		os.Setenv(test.variable, "")
+	}
+}
+
 // vim: tabstop=4 softtabstop=4 shiftwidth=4 noexpandtab tw=80